@@ -0,0 +1,313 @@
+// Package config loads the server settings. Defaults are overridden by a
+// YAML or TOML file, then by environment variables, then by command line
+// flags.
+package config
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Port        string    `yaml:"port" toml:"port"`
+	DatabaseURL string    `yaml:"database_url" toml:"database_url"`
+	MaxPageSize int       `yaml:"max_page_size" toml:"max_page_size"`
+	DB          DB        `yaml:"db" toml:"db"`
+	Shutdown    Shutdown  `yaml:"shutdown" toml:"shutdown"`
+	Auth        Auth      `yaml:"auth" toml:"auth"`
+	CORS        CORS      `yaml:"cors" toml:"cors"`
+	Log         Log       `yaml:"log" toml:"log"`
+	Tracing     Tracing   `yaml:"tracing" toml:"tracing"`
+	Scheduler   Scheduler `yaml:"scheduler" toml:"scheduler"`
+}
+
+type DB struct {
+	// Timeout bounds the store calls of one request; zero means no limit.
+	Timeout         time.Duration `yaml:"timeout" toml:"timeout"`
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+}
+
+type Shutdown struct {
+	// Delay is how long /readyz fails before the server stops accepting
+	// connections; Timeout is how long requests then have to finish.
+	Delay   time.Duration `yaml:"delay" toml:"delay"`
+	Timeout time.Duration `yaml:"timeout" toml:"timeout"`
+}
+
+type Auth struct {
+	JWTSecret        string `yaml:"jwt_secret" toml:"jwt_secret"`
+	JWTPublicKeyFile string `yaml:"jwt_public_key_file" toml:"jwt_public_key_file"`
+	JWKSFile         string `yaml:"jwks_file" toml:"jwks_file"`
+	JWTIssuer        string `yaml:"jwt_issuer" toml:"jwt_issuer"`
+	JWTAudience      string `yaml:"jwt_audience" toml:"jwt_audience"`
+	// JWTMaxAge bounds how far in the future a bearer token may expire;
+	// zero lifts the bound.
+	JWTMaxAge time.Duration `yaml:"jwt_max_age" toml:"jwt_max_age"`
+	APIKeys   bool          `yaml:"api_keys" toml:"api_keys"`
+	Legacy    bool          `yaml:"legacy" toml:"legacy"`
+	// Admins are the principals allowed to change the shared exchange rates.
+	Admins []string `yaml:"admins" toml:"admins"`
+}
+
+type CORS struct {
+	// AllowOrigins lists the origins browsers may call the API from; empty
+	// disables CORS.
+	AllowOrigins []string `yaml:"allow_origins" toml:"allow_origins"`
+}
+
+type Log struct {
+	Level string `yaml:"level" toml:"level"`
+}
+
+type Tracing struct {
+	Exporter string `yaml:"exporter" toml:"exporter"`
+}
+
+type Scheduler struct {
+	// Interval is how often due recurring expenses are created; zero
+	// disables the scheduler.
+	Interval time.Duration `yaml:"interval" toml:"interval"`
+}
+
+// Default returns the settings used for anything left unset.
+func Default() Config {
+	return Config{
+		Port:        ":2565",
+		MaxPageSize: 100,
+		DB: DB{
+			Timeout:      5 * time.Second,
+			MaxIdleConns: 2,
+		},
+		Shutdown:  Shutdown{Timeout: 10 * time.Second},
+		Auth:      Auth{APIKeys: true, JWTMaxAge: 24 * time.Hour},
+		Log:       Log{Level: "info"},
+		Tracing:   Tracing{Exporter: "none"},
+		Scheduler: Scheduler{Interval: time.Minute},
+	}
+}
+
+// binding ties a setting to its environment variable and flag.
+type binding struct {
+	env, flag, usage string
+	value            flag.Value
+}
+
+func (c *Config) bindings() []binding {
+	return []binding{
+		{"PORT", "port", "listen address", (*stringValue)(&c.Port)},
+		{"DATABASE_URL", "database-url", "postgres://..., sqlite://<file> or memory://[<file>]", (*stringValue)(&c.DatabaseURL)},
+		{"MAX_PAGE_SIZE", "max-page-size", "largest page a client may ask for", (*intValue)(&c.MaxPageSize)},
+		{"DB_TIMEOUT", "db-timeout", "limit on the store calls of a request, 0 for none", (*durationValue)(&c.DB.Timeout)},
+		{"DB_MAX_OPEN_CONNS", "db-max-open-conns", "open connections to Postgres, 0 for no limit", (*intValue)(&c.DB.MaxOpenConns)},
+		{"DB_MAX_IDLE_CONNS", "db-max-idle-conns", "idle connections kept to Postgres", (*intValue)(&c.DB.MaxIdleConns)},
+		{"DB_CONN_MAX_LIFETIME", "db-conn-max-lifetime", "age at which Postgres connections are replaced, 0 for never", (*durationValue)(&c.DB.ConnMaxLifetime)},
+		{"SHUTDOWN_DELAY", "shutdown-delay", "time /readyz fails before shutting down", (*durationValue)(&c.Shutdown.Delay)},
+		{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "time requests have to finish on shutdown", (*durationValue)(&c.Shutdown.Timeout)},
+		{"AUTH_JWT_SECRET", "auth-jwt-secret", "HMAC secret of bearer tokens", (*stringValue)(&c.Auth.JWTSecret)},
+		{"AUTH_JWT_PUBLIC_KEY_FILE", "auth-jwt-public-key-file", "PEM public key of bearer tokens", (*stringValue)(&c.Auth.JWTPublicKeyFile)},
+		{"AUTH_JWKS_FILE", "auth-jwks-file", "JWKS file of bearer token keys", (*stringValue)(&c.Auth.JWKSFile)},
+		{"AUTH_JWT_ISSUER", "auth-jwt-issuer", "required iss of bearer tokens", (*stringValue)(&c.Auth.JWTIssuer)},
+		{"AUTH_JWT_AUDIENCE", "auth-jwt-audience", "required aud of bearer tokens", (*stringValue)(&c.Auth.JWTAudience)},
+		{"AUTH_JWT_MAX_AGE", "auth-jwt-max-age", "longest time until a bearer token expires, 0 for no limit", (*durationValue)(&c.Auth.JWTMaxAge)},
+		{"AUTH_API_KEYS", "auth-api-keys", "accept API keys", (*boolValue)(&c.Auth.APIKeys)},
+		{"AUTH_LEGACY", "auth-legacy", "accept the legacy shared Authorization header", (*boolValue)(&c.Auth.Legacy)},
+		{"AUTH_ADMINS", "auth-admins", "comma separated principals allowed to change exchange rates", (*listValue)(&c.Auth.Admins)},
+		{"CORS_ALLOW_ORIGINS", "cors-allow-origins", "comma separated origins allowed by CORS", (*listValue)(&c.CORS.AllowOrigins)},
+		{"LOG_LEVEL", "log-level", "debug, info, warn or error", (*stringValue)(&c.Log.Level)},
+		{"OTEL_TRACES_EXPORTER", "traces-exporter", "otlp, stdout or none", (*stringValue)(&c.Tracing.Exporter)},
+		{"SCHEDULER_INTERVAL", "scheduler-interval", "how often recurring expenses are created, 0 to disable", (*durationValue)(&c.Scheduler.Interval)},
+	}
+}
+
+// Load reads the settings from the file named by -config or CONFIG_FILE,
+// lookupEnv and the flags in args, then validates them. It returns the
+// arguments left after the flags.
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, []string, error) {
+	cfg := Default()
+	bindings := cfg.bindings()
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	file, _ := lookupEnv("CONFIG_FILE")
+	fs.StringVar(&file, "config", file, "YAML or TOML config file")
+	for _, b := range bindings {
+		fs.Var(b.value, b.flag, b.usage+" ($"+b.env+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	// Flags win, but the file has to be read first; remember them and
+	// apply them again at the end.
+	flags := map[string]string{}
+	fs.Visit(func(f *flag.Flag) { flags[f.Name] = f.Value.String() })
+	cfg = Default()
+
+	if file != "" {
+		if err := cfg.loadFile(file); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, b := range bindings {
+		if v, ok := lookupEnv(b.env); ok && v != "" {
+			if err := b.value.Set(v); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", b.env, err)
+			}
+		}
+	}
+	for name, v := range flags {
+		if err := fs.Set(name, v); err != nil {
+			return nil, nil, fmt.Errorf("-%s: %w", name, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return &cfg, fs.Args(), nil
+}
+
+// loadFile reads path as YAML or TOML by its extension. Unknown keys are
+// errors, so that typos do not go unnoticed.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && err != io.EOF {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("%s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("%s: config files must be .yaml, .yml or .toml", path)
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Port != "", "port is required")
+	check(c.DatabaseURL != "", "database_url is required")
+	check(c.MaxPageSize > 0, "max_page_size must be positive")
+	check(c.DB.Timeout >= 0, "db.timeout must not be negative")
+	check(c.DB.MaxOpenConns >= 0, "db.max_open_conns must not be negative")
+	check(c.DB.MaxIdleConns >= 0, "db.max_idle_conns must not be negative")
+	check(c.DB.ConnMaxLifetime >= 0, "db.conn_max_lifetime must not be negative")
+	check(c.Shutdown.Delay >= 0, "shutdown.delay must not be negative")
+	check(c.Shutdown.Timeout > 0, "shutdown.timeout must be positive")
+	check(oneOf(c.Log.Level, "debug", "info", "warn", "error"), "log.level must be debug, info, warn or error, not %q", c.Log.Level)
+	check(oneOf(c.Tracing.Exporter, "none", "otlp", "stdout"), "tracing.exporter must be none, otlp or stdout, not %q", c.Tracing.Exporter)
+	check(c.Auth.JWTMaxAge >= 0, "auth.jwt_max_age must not be negative")
+	check(c.Scheduler.Interval >= 0, "scheduler.interval must not be negative")
+	for _, origin := range c.CORS.AllowOrigins {
+		check(validOrigin(origin), "cors.allow_origins: %q is not * or scheme://host[:port]", origin)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func oneOf(s string, values ...string) bool {
+	for _, v := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func validOrigin(origin string) bool {
+	if origin == "*" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.Path == "" && u.RawQuery == "" && u.User == nil
+}
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error { *v = stringValue(s); return nil }
+func (v *stringValue) String() string     { return string(*v) }
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a number", s)
+	}
+	*v = intValue(n)
+	return nil
+}
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("%q is not true or false", s)
+	}
+	*v = boolValue(b)
+	return nil
+}
+func (v *boolValue) String() string   { return strconv.FormatBool(bool(*v)) }
+func (v *boolValue) IsBoolFlag() bool { return true }
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a duration such as 5s", s)
+	}
+	*v = durationValue(d)
+	return nil
+}
+func (v *durationValue) String() string { return time.Duration(*v).String() }
+
+type listValue []string
+
+func (v *listValue) Set(s string) error {
+	*v = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v = append(*v, item)
+		}
+	}
+	return nil
+}
+func (v *listValue) String() string { return strings.Join(*v, ",") }
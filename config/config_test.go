@@ -0,0 +1,112 @@
+//go:build unit
+// +build unit
+
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("defaults apply to anything unset", func(t *testing.T) {
+		cfg, args, err := Load([]string{"migrate", "up"}, env(map[string]string{"DATABASE_URL": "memory://"}))
+		if assert.NoError(t, err) {
+			want := Default()
+			want.DatabaseURL = "memory://"
+			assert.Equal(t, &want, cfg)
+			assert.Equal(t, []string{"migrate", "up"}, args)
+		}
+	})
+
+	t.Run("flags beat env and env beats the file", func(t *testing.T) {
+		file := writeFile(t, "server.yaml", `
+port: ":8000"
+database_url: postgres://file
+db:
+  timeout: 2s
+  max_open_conns: 20
+cors:
+  allow_origins: ["https://file.example"]
+log:
+  level: warn
+`)
+		cfg, _, err := Load(
+			[]string{"-config", file, "-port", ":9000", "-auth-legacy"},
+			env(map[string]string{"PORT": ":8500", "DB_TIMEOUT": "3s", "CORS_ALLOW_ORIGINS": "https://a.example, https://b.example"}),
+		)
+		if assert.NoError(t, err) {
+			assert.Equal(t, ":9000", cfg.Port)
+			assert.Equal(t, "postgres://file", cfg.DatabaseURL)
+			assert.Equal(t, 3*time.Second, cfg.DB.Timeout)
+			assert.Equal(t, 20, cfg.DB.MaxOpenConns)
+			assert.Equal(t, []string{"https://a.example", "https://b.example"}, cfg.CORS.AllowOrigins)
+			assert.Equal(t, "warn", cfg.Log.Level)
+			assert.True(t, cfg.Auth.Legacy)
+			assert.True(t, cfg.Auth.APIKeys)
+		}
+	})
+
+	t.Run("toml files are read too", func(t *testing.T) {
+		file := writeFile(t, "server.toml", `
+database_url = "sqlite://expenses.db"
+
+[shutdown]
+delay = "5s"
+
+[auth]
+api_keys = false
+jwt_secret = "s3cret"
+`)
+		cfg, _, err := Load(nil, env(map[string]string{"CONFIG_FILE": file}))
+		if assert.NoError(t, err) {
+			assert.Equal(t, "sqlite://expenses.db", cfg.DatabaseURL)
+			assert.Equal(t, 5*time.Second, cfg.Shutdown.Delay)
+			assert.False(t, cfg.Auth.APIKeys)
+			assert.Equal(t, "s3cret", cfg.Auth.JWTSecret)
+		}
+	})
+
+	t.Run("unknown keys in files are rejected", func(t *testing.T) {
+		for name, content := range map[string]string{
+			"server.yaml": "database_url: memory://\ndb:\n  timeuot: 2s\n",
+			"server.toml": "database_url = \"memory://\"\n[db]\ntimeuot = \"2s\"\n",
+		} {
+			_, _, err := Load([]string{"-config", writeFile(t, name, content)}, env(nil))
+			assert.ErrorContains(t, err, "timeuot", name)
+		}
+	})
+
+	t.Run("malformed env values are rejected", func(t *testing.T) {
+		_, _, err := Load(nil, env(map[string]string{"DATABASE_URL": "memory://", "DB_TIMEOUT": "5"}))
+		assert.EqualError(t, err, `DB_TIMEOUT: "5" is not a duration such as 5s`)
+	})
+
+	t.Run("every invalid setting is reported", func(t *testing.T) {
+		_, _, err := Load(
+			[]string{"-max-page-size", "0", "-log-level", "loud", "-cors-allow-origins", "https://ok.example,ftp://bad.example"},
+			env(nil),
+		)
+		assert.EqualError(t, err, `invalid config: database_url is required; max_page_size must be positive; `+
+			`log.level must be debug, info, warn or error, not "loud"; `+
+			`cors.allow_origins: "ftp://bad.example" is not * or scheme://host[:port]`)
+	})
+}
@@ -1,6 +0,0 @@
-CREATE TABLE IF NOT EXISTS expenses (
-                                        id SERIAL PRIMARY KEY,
-                                        title TEXT,
-                                        amount FLOAT,
-                                        note TEXT,
-                                        tags TEXT[])
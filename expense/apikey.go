@@ -0,0 +1,104 @@
+package expense
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type APIKey struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Key       string     `json:"key,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+func newAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// IssueAPIKey stores a new key for owner and returns it, including the plain
+// key which is not kept anywhere.
+func IssueAPIKey(ctx context.Context, keys APIKeyStore, owner, name string) (APIKey, error) {
+	key, err := newAPIKey()
+	if err != nil {
+		return APIKey{Name: name}, err
+	}
+
+	k, err := keys.CreateAPIKey(ctx, owner, name, hashAPIKey(key))
+	if err != nil {
+		return k, err
+	}
+	k.Key = key
+	return k, nil
+}
+
+// CreateAPIKeyHandler issues a key owned by the caller. The plain key is only
+// ever returned in this response.
+func (h *handler) CreateAPIKeyHandler(c echo.Context) error {
+	p, ok := PrincipalFrom(c)
+	if !ok {
+		return echo.ErrUnauthorized
+	}
+
+	var req APIKey
+	if err := c.Bind(&req); err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	k, err := IssueAPIKey(ctx, h.Store, p.Subject, req.Name)
+	if err != nil {
+		return storeError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, k)
+}
+
+func (h *handler) GetAPIKeysHandler(c echo.Context) error {
+	p, ok := PrincipalFrom(c)
+	if !ok {
+		return echo.ErrUnauthorized
+	}
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	keys, err := h.Store.ListAPIKeys(ctx, p.Subject)
+	if err != nil {
+		return storeError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, keys)
+}
+
+func (h *handler) RevokeAPIKeyHandler(c echo.Context) error {
+	p, ok := PrincipalFrom(c)
+	if !ok {
+		return echo.ErrUnauthorized
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	if err := h.Store.RevokeAPIKey(ctx, p.Subject, id); err != nil {
+		return storeError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,344 @@
+package expense
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const principalKey = "principal"
+
+// ErrNoCredentials is returned by an Authenticator when the request carries
+// no credentials it understands, so the next one gets a chance.
+var ErrNoCredentials = errors.New("no credentials")
+
+// ErrInvalidCredentials is wrapped by the errors of an Authenticator that
+// rejects the credentials it was given. Any other error means they could
+// not be checked.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+func invalidCredentials(err error) error {
+	return fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+}
+
+type Principal struct {
+	Subject string `json:"subject"`
+	Method  string `json:"method"`
+}
+
+type Authenticator interface {
+	Authenticate(r *http.Request) (Principal, error)
+}
+
+// Authenticate tries each authenticator in turn and stores the first
+// principal found on the echo context. Rejected credentials answer 401;
+// failures to check them, such as an unreachable database, answer 5xx.
+func Authenticate(authenticators ...Authenticator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			for _, a := range authenticators {
+				p, err := a.Authenticate(c.Request())
+				if errors.Is(err, ErrNoCredentials) {
+					continue
+				}
+				if errors.Is(err, ErrInvalidCredentials) {
+					break
+				}
+				if err != nil {
+					return storeError(c, err)
+				}
+				c.Set(principalKey, p)
+				return next(c)
+			}
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="expenses"`)
+			return echo.ErrUnauthorized
+		}
+	}
+}
+
+// RequireAdmin lets through only requests authenticated as one of admins and
+// answers 403 to the rest. It guards data shared by every owner.
+func RequireAdmin(admins []string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			p, ok := PrincipalFrom(c)
+			if !ok {
+				return echo.ErrUnauthorized
+			}
+			if !containsString(admins, p.Subject) {
+				return echo.ErrForbidden
+			}
+			return next(c)
+		}
+	}
+}
+
+func PrincipalFrom(c echo.Context) (Principal, bool) {
+	p, ok := c.Get(principalKey).(Principal)
+	return p, ok
+}
+
+// ownerID is the owner every expense read or written by the request is
+// scoped to.
+func ownerID(c echo.Context) (string, error) {
+	p, ok := PrincipalFrom(c)
+	if !ok || p.Subject == "" {
+		return "", echo.ErrUnauthorized
+	}
+	return p.Subject, nil
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	auth := r.Header.Get(echo.HeaderAuthorization)
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:]), true
+	}
+	return "", false
+}
+
+const legacyToken = "November 10, 2009"
+
+// LegacyAuthenticator accepts the shared Authorization header the API
+// started with. It should only be enabled explicitly.
+type LegacyAuthenticator struct{}
+
+func (LegacyAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	auth := r.Header.Values(echo.HeaderAuthorization)
+	if auth == nil {
+		return Principal{}, ErrNoCredentials
+	}
+	if auth[0] != legacyToken {
+		return Principal{}, ErrNoCredentials
+	}
+	return Principal{Subject: "legacy", Method: "legacy"}, nil
+}
+
+// JWTAuthenticator validates HS256 or RS256 bearer tokens. The token subject
+// becomes the principal. Tokens must expire, and no later than MaxAge from
+// now when it is set.
+type JWTAuthenticator struct {
+	Issuer   string
+	Audience string
+	MaxAge   time.Duration
+
+	secret    []byte
+	publicKey *rsa.PublicKey
+	jwks      map[string]interface{}
+}
+
+// NewJWTAuthenticator builds an authenticator from an HS256 secret, an RS256
+// PEM public key file and/or a local JWKS file; any of them may be empty.
+func NewJWTAuthenticator(hmacSecret, publicKeyFile, jwksFile string) (*JWTAuthenticator, error) {
+	a := &JWTAuthenticator{}
+
+	if hmacSecret != "" {
+		a.secret = []byte(hmacSecret)
+	}
+	if publicKeyFile != "" {
+		raw, err := os.ReadFile(publicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if a.publicKey, err = jwt.ParseRSAPublicKeyFromPEM(raw); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", publicKeyFile, err)
+		}
+	}
+	if jwksFile != "" {
+		var err error
+		if a.jwks, err = loadJWKS(jwksFile); err != nil {
+			return nil, err
+		}
+	}
+	if a.secret == nil && a.publicKey == nil && len(a.jwks) == 0 {
+		return nil, errors.New("jwt authenticator needs at least one key")
+	}
+	return a, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+func loadJWKS(path string) (map[string]interface{}, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	keys := map[string]interface{}{}
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if k.Kid == "" {
+			return nil, fmt.Errorf("parse %s: key %d has no kid", path, i)
+		}
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil || len(e) > 4 {
+				return nil, fmt.Errorf("parse %s: invalid RSA key %q", path, k.Kid)
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				return nil, fmt.Errorf("parse %s: invalid oct key %q", path, k.Kid)
+			}
+			keys[k.Kid] = secret
+		}
+	}
+	return keys, nil
+}
+
+// keyFor picks the verification key for a token: by kid from the JWKS, or
+// else the configured key for its algorithm. The algorithm must match the
+// key type so an RSA public key is never used as an HMAC secret.
+func (a *JWTAuthenticator) keyFor(token *jwt.Token) (interface{}, error) {
+	var key interface{}
+	if kid, _ := token.Header["kid"].(string); kid != "" {
+		k, ok := a.jwks[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		key = k
+	} else if token.Method == jwt.SigningMethodHS256 && a.secret != nil {
+		key = a.secret
+	} else if token.Method == jwt.SigningMethodRS256 && a.publicKey != nil {
+		key = a.publicKey
+	} else {
+		return nil, fmt.Errorf("no key for signing method %v", token.Header["alg"])
+	}
+
+	switch key.(type) {
+	case []byte:
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+	case *rsa.PublicKey:
+		if token.Method != jwt.SigningMethodRS256 {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+	}
+	return key, nil
+}
+
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	raw, ok := bearerToken(r)
+	if !ok {
+		return Principal{}, ErrNoCredentials
+	}
+
+	opts := []jwt.ParserOption{jwt.WithValidMethods([]string{"HS256", "RS256"}), jwt.WithExpirationRequired()}
+	if a.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(a.Issuer))
+	}
+	if a.Audience != "" {
+		opts = append(opts, jwt.WithAudience(a.Audience))
+	}
+	claims := jwt.RegisteredClaims{}
+	if _, err := jwt.NewParser(opts...).ParseWithClaims(raw, &claims, a.keyFor); err != nil {
+		return Principal{}, invalidCredentials(err)
+	}
+	if claims.Subject == "" {
+		return Principal{}, invalidCredentials(errors.New("token has no subject"))
+	}
+	if a.MaxAge > 0 && claims.ExpiresAt.After(time.Now().Add(a.MaxAge)) {
+		return Principal{}, invalidCredentials(fmt.Errorf("token expires more than %v from now", a.MaxAge))
+	}
+
+	return Principal{Subject: claims.Subject, Method: "jwt"}, nil
+}
+
+const apiKeyPrefix = "exp_"
+
+// APIKeyAuthenticator looks up keys sent as "X-API-Key: <key>" or
+// "Authorization: ApiKey <key>". Only the SHA-256 of a key is stored.
+type APIKeyAuthenticator struct {
+	Keys APIKeyStore
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (a APIKeyAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	key := r.Header.Get("X-API-Key")
+	if auth := r.Header.Get(echo.HeaderAuthorization); key == "" && len(auth) > 7 && strings.EqualFold(auth[:7], "ApiKey ") {
+		key = strings.TrimSpace(auth[7:])
+	}
+	if key == "" {
+		return Principal{}, ErrNoCredentials
+	}
+
+	owner, err := a.Keys.APIKeyOwner(r.Context(), hashAPIKey(key))
+	if errors.Is(err, errAPIKeyNotFound) {
+		return Principal{}, invalidCredentials(err)
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+	return Principal{Subject: owner, Method: "api_key"}, nil
+}
+
+type AuthConfig struct {
+	JWTSecret        string
+	JWTPublicKeyFile string
+	JWKSFile         string
+	JWTIssuer        string
+	JWTAudience      string
+	JWTMaxAge        time.Duration
+	APIKeys          bool
+	Legacy           bool
+}
+
+// NewAuthenticators builds the authenticator chain described by cfg. The
+// legacy shared header is only accepted when cfg.Legacy is set.
+func NewAuthenticators(cfg AuthConfig, keys APIKeyStore) ([]Authenticator, error) {
+	var authenticators []Authenticator
+
+	if cfg.JWTSecret != "" || cfg.JWTPublicKeyFile != "" || cfg.JWKSFile != "" {
+		a, err := NewJWTAuthenticator(cfg.JWTSecret, cfg.JWTPublicKeyFile, cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		a.Issuer = cfg.JWTIssuer
+		a.Audience = cfg.JWTAudience
+		a.MaxAge = cfg.JWTMaxAge
+		authenticators = append(authenticators, a)
+	}
+	if cfg.APIKeys {
+		authenticators = append(authenticators, APIKeyAuthenticator{Keys: keys})
+	}
+	if cfg.Legacy {
+		authenticators = append(authenticators, LegacyAuthenticator{})
+	}
+	if len(authenticators) == 0 {
+		return nil, errors.New("no authentication method configured")
+	}
+	return authenticators, nil
+}
@@ -0,0 +1,223 @@
+//go:build unit
+// +build unit
+
+package expense
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func authRequest(mw echo.MiddlewareFunc, header, value string) *httptest.ResponseRecorder {
+	e := echo.New()
+	e.Use(mw)
+	e.GET("/auth", func(c echo.Context) error {
+		p, _ := PrincipalFrom(c)
+		return c.JSON(http.StatusOK, p)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/auth", nil)
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.Claims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	valid := jwt.RegisteredClaims{Subject: "alice", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+
+	t.Run("hs256 token success", func(t *testing.T) {
+		a, err := NewJWTAuthenticator("s3cret", "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		token := signToken(t, jwt.SigningMethodHS256, []byte("s3cret"), "", valid)
+
+		rec := authRequest(Authenticate(a), echo.HeaderAuthorization, "Bearer "+token)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"subject":"alice","method":"jwt"}`, rec.Body.String())
+	})
+
+	t.Run("wrong secret", func(t *testing.T) {
+		a, _ := NewJWTAuthenticator("s3cret", "", "")
+		token := signToken(t, jwt.SigningMethodHS256, []byte("guess"), "", valid)
+
+		rec := authRequest(Authenticate(a), echo.HeaderAuthorization, "Bearer "+token)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		a, _ := NewJWTAuthenticator("s3cret", "", "")
+		token := signToken(t, jwt.SigningMethodHS256, []byte("s3cret"), "", jwt.RegisteredClaims{Subject: "alice", ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute))})
+
+		rec := authRequest(Authenticate(a), echo.HeaderAuthorization, "Bearer "+token)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("token without exp", func(t *testing.T) {
+		a, _ := NewJWTAuthenticator("s3cret", "", "")
+		token := signToken(t, jwt.SigningMethodHS256, []byte("s3cret"), "", jwt.RegisteredClaims{Subject: "alice"})
+
+		rec := authRequest(Authenticate(a), echo.HeaderAuthorization, "Bearer "+token)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("token expiring past max age", func(t *testing.T) {
+		a, _ := NewJWTAuthenticator("s3cret", "", "")
+		a.MaxAge = time.Hour
+		token := signToken(t, jwt.SigningMethodHS256, []byte("s3cret"), "", jwt.RegisteredClaims{Subject: "alice", ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour))})
+
+		rec := authRequest(Authenticate(a), echo.HeaderAuthorization, "Bearer "+token)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("audience may be an array", func(t *testing.T) {
+		a, _ := NewJWTAuthenticator("s3cret", "", "")
+		a.Audience = "expenses"
+		claims := valid
+		claims.Audience = jwt.ClaimStrings{"billing", "expenses"}
+		other := valid
+		other.Audience = jwt.ClaimStrings{"billing"}
+
+		ok := authRequest(Authenticate(a), echo.HeaderAuthorization, "Bearer "+signToken(t, jwt.SigningMethodHS256, []byte("s3cret"), "", claims))
+		wrong := authRequest(Authenticate(a), echo.HeaderAuthorization, "Bearer "+signToken(t, jwt.SigningMethodHS256, []byte("s3cret"), "", other))
+
+		assert.Equal(t, http.StatusOK, ok.Code)
+		assert.Equal(t, http.StatusUnauthorized, wrong.Code)
+	})
+
+	t.Run("rs256 token from jwks file", func(t *testing.T) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jwks := fmt.Sprintf(`{"keys":[{"kty":"RSA","kid":"k1","use":"sig","n":"%s","e":"%s"}]}`,
+			base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()))
+		path := filepath.Join(t.TempDir(), "jwks.json")
+		if err := os.WriteFile(path, []byte(jwks), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		a, err := NewJWTAuthenticator("", "", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ok := authRequest(Authenticate(a), echo.HeaderAuthorization, "Bearer "+signToken(t, jwt.SigningMethodRS256, key, "k1", valid))
+		unknownKid := authRequest(Authenticate(a), echo.HeaderAuthorization, "Bearer "+signToken(t, jwt.SigningMethodRS256, key, "k2", valid))
+
+		assert.Equal(t, http.StatusOK, ok.Code)
+		assert.Equal(t, http.StatusUnauthorized, unknownKid.Code)
+	})
+}
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+
+	t.Run("api key success", func(t *testing.T) {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mock.ExpectQuery("SELECT owner_id FROM api_keys WHERE key_hash=$1 AND revoked_at IS NULL").
+			WithArgs(hashAPIKey("exp_abc")).
+			WillReturnRows(sqlmock.NewRows([]string{"owner_id"}).AddRow("bob"))
+
+		rec := authRequest(Authenticate(APIKeyAuthenticator{Keys: NewPostgresStore(db)}), "X-API-Key", "exp_abc")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"subject":"bob","method":"api_key"}`, rec.Body.String())
+	})
+
+	t.Run("unknown api key", func(t *testing.T) {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mock.ExpectQuery("SELECT owner_id FROM api_keys WHERE key_hash=$1 AND revoked_at IS NULL").
+			WithArgs(hashAPIKey("exp_nope")).
+			WillReturnRows(sqlmock.NewRows([]string{"owner_id"}))
+
+		rec := authRequest(Authenticate(APIKeyAuthenticator{Keys: NewPostgresStore(db)}), echo.HeaderAuthorization, "ApiKey exp_nope")
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("store failure is not an authentication failure", func(t *testing.T) {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mock.ExpectQuery("SELECT owner_id FROM api_keys WHERE key_hash=$1 AND revoked_at IS NULL").
+			WithArgs(hashAPIKey("exp_abc")).
+			WillReturnError(errors.New("connection refused"))
+
+		rec := authRequest(Authenticate(APIKeyAuthenticator{Keys: NewPostgresStore(db)}), "X-API-Key", "exp_abc")
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Empty(t, rec.Header().Get(echo.HeaderWWWAuthenticate))
+	})
+}
+
+func TestNewAuthenticators(t *testing.T) {
+
+	t.Run("legacy header rejected unless enabled", func(t *testing.T) {
+		authenticators, err := NewAuthenticators(AuthConfig{JWTSecret: "s3cret"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := authRequest(Authenticate(authenticators...), echo.HeaderAuthorization, "November 10, 2009")
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("legacy header accepted with flag", func(t *testing.T) {
+		authenticators, err := NewAuthenticators(AuthConfig{JWTSecret: "s3cret", Legacy: true}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := authRequest(Authenticate(authenticators...), echo.HeaderAuthorization, "November 10, 2009")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("no method configured", func(t *testing.T) {
+		_, err := NewAuthenticators(AuthConfig{}, nil)
+
+		assert.Error(t, err)
+	})
+}
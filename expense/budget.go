@@ -0,0 +1,378 @@
+package expense
+
+import (
+	"context"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	BudgetOK       = "ok"
+	BudgetWarning  = "warning"
+	BudgetExceeded = "exceeded"
+
+	// budgetWarningPercent is how much of a budget may be spent before it
+	// is flagged.
+	budgetWarningPercent = 80
+)
+
+// Budget limits what may be spent on expenses tagged Tag in Currency during
+// each Period.
+type Budget struct {
+	ID       int    `json:"id"`
+	Tag      string `json:"tag"`
+	Amount   Money  `json:"amount"`
+	Currency string `json:"currency"`
+	Period   string `json:"period"`
+}
+
+// BudgetStatus is what has been spent against a budget in one period.
+// PeriodEnd is exclusive.
+type BudgetStatus struct {
+	Budget
+	PeriodStart string  `json:"period_start"`
+	PeriodEnd   string  `json:"period_end"`
+	Spent       Money   `json:"spent"`
+	Remaining   Money   `json:"remaining"`
+	Percent     float64 `json:"percent"`
+	State       string  `json:"state"`
+}
+
+// BudgetAlert flags a budget that an expense pushed into a worse state.
+type BudgetAlert struct {
+	BudgetID    int     `json:"budget_id"`
+	Tag         string  `json:"tag"`
+	PeriodStart string  `json:"period_start"`
+	Amount      Money   `json:"amount"`
+	Spent       Money   `json:"spent"`
+	Percent     float64 `json:"percent"`
+	State       string  `json:"state"`
+}
+
+// expenseResult is the response to a create or update, which also warns
+// about the budgets the change pushed over a threshold.
+type expenseResult struct {
+	Expense
+	BudgetAlerts []BudgetAlert `json:"budget_alerts,omitempty"`
+}
+
+func normalizeBudget(b *Budget) {
+	b.Tag = strings.TrimSpace(b.Tag)
+	b.Currency = strings.ToUpper(strings.TrimSpace(b.Currency))
+	if b.Currency == "" {
+		b.Currency = DefaultCurrency
+	}
+	b.Period = strings.ToLower(strings.TrimSpace(b.Period))
+	if b.Period == "" {
+		b.Period = PeriodMonth
+	}
+}
+
+func validateBudget(b Budget) []FieldError {
+	var errs []FieldError
+	add := func(field, code, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if b.Tag == "" {
+		add("tag", CodeRequired, "tag is required")
+	} else if utf8.RuneCountInString(b.Tag) > maxTagLength {
+		add("tag", CodeTooLong, "tag must be at most %d characters", maxTagLength)
+	}
+
+	if b.Amount <= 0 {
+		add("amount", CodeMin, "amount must be greater than zero")
+	} else if b.Amount > maxAmount {
+		add("amount", CodeMax, "amount must be at most %s", maxAmount)
+	}
+
+	if digits, ok := currencies[b.Currency]; !ok {
+		add("currency", CodeInvalid, "currency %q is not a supported ISO 4217 code", b.Currency)
+	} else if !fitsMinorUnits(b.Amount, digits) {
+		add("amount", CodeScale, "%s amounts must not have more than %d decimal places", b.Currency, digits)
+	}
+
+	switch b.Period {
+	case PeriodWeek, PeriodMonth, PeriodYear:
+	default:
+		add("period", CodeInvalid, "period must be week, month or year")
+	}
+
+	return errs
+}
+
+// budgetState is ok below 80% of the limit, a warning from there up to the
+// limit itself and exceeded beyond it.
+func budgetState(spent, limit Money) string {
+	switch {
+	case spent > limit:
+		return BudgetExceeded
+	case spent*100 >= limit*budgetWarningPercent:
+		return BudgetWarning
+	default:
+		return BudgetOK
+	}
+}
+
+var budgetStateRank = map[string]int{BudgetOK: 0, BudgetWarning: 1, BudgetExceeded: 2}
+
+// percentOf is spent as a percentage of limit, to two decimal places.
+func percentOf(spent, limit Money) float64 {
+	if limit == 0 {
+		return 0
+	}
+	return math.Round(float64(spent)*10000/float64(limit)) / 100
+}
+
+// budgetSpent sums the owner's expenses counting against b in [start, end).
+func budgetSpent(ctx context.Context, store ExpenseStore, owner string, b Budget, start, end time.Time) (Money, error) {
+	rows, err := store.Summarize(ctx, ReportQuery{Filter: ListQuery{
+		OwnerID:   owner,
+		Tags:      []string{b.Tag},
+		SpentFrom: &start,
+		SpentTo:   &end,
+	}})
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range rows {
+		if r.Currency == b.Currency {
+			return r.Total, nil
+		}
+	}
+	return 0, nil
+}
+
+// countsAgainst reports whether ex is part of b in the period [start, end).
+func countsAgainst(ex *Expense, b Budget, start, end time.Time) bool {
+	if ex == nil || ex.SpentAt == nil || ex.Currency != b.Currency || !containsString(ex.Tags, b.Tag) {
+		return false
+	}
+	return !ex.SpentAt.Before(start) && ex.SpentAt.Before(end)
+}
+
+// budgetAlerts compares the budgets ex counts against before and after it
+// was stored; prev is what an update replaced.
+func budgetAlerts(ctx context.Context, budgets []Budget, store ExpenseStore, owner string, ex Expense, prev *Expense) ([]BudgetAlert, error) {
+	if ex.SpentAt == nil {
+		return nil, nil
+	}
+	var alerts []BudgetAlert
+	for _, b := range budgets {
+		start, end := periodRange(b.Period, *ex.SpentAt)
+		if !countsAgainst(&ex, b, start, end) {
+			continue
+		}
+		after, err := budgetSpent(ctx, store, owner, b, start, end)
+		if err != nil {
+			return nil, err
+		}
+		before := after - ex.Amount
+		if countsAgainst(prev, b, start, end) {
+			before += prev.Amount
+		}
+
+		state := budgetState(after, b.Amount)
+		if budgetStateRank[state] <= budgetStateRank[budgetState(before, b.Amount)] {
+			continue
+		}
+		alerts = append(alerts, BudgetAlert{
+			BudgetID:    b.ID,
+			Tag:         b.Tag,
+			PeriodStart: start.Format(dateLayout),
+			Amount:      b.Amount,
+			Spent:       after,
+			Percent:     percentOf(after, b.Amount),
+			State:       state,
+		})
+	}
+	return alerts, nil
+}
+
+// withBudgetAlerts adds the alerts for ex to the response. Budgets are
+// advisory, so failing to check them is logged rather than failing a write
+// that has already happened.
+func (h *handler) withBudgetAlerts(c echo.Context, owner string, budgets []Budget, ex Expense, prev *Expense) expenseResult {
+	res := expenseResult{Expense: ex}
+	if len(budgets) == 0 {
+		return res
+	}
+	alerts, err := budgetAlerts(c.Request().Context(), budgets, h.Store, owner, ex, prev)
+	if err != nil {
+		logger(c).Error("budget check failed", "error", err)
+		return res
+	}
+	res.BudgetAlerts = alerts
+	return res
+}
+
+// ownerBudgets lists the budgets to check a write against, or none if they
+// can not be read.
+func (h *handler) ownerBudgets(c echo.Context, owner string) []Budget {
+	budgets, err := h.Store.ListBudgets(c.Request().Context(), owner)
+	if err != nil {
+		logger(c).Error("budget check failed", "error", err)
+		return nil
+	}
+	return budgets
+}
+
+func (h *handler) CreateBudgetHandler(c echo.Context) error {
+	owner, err := ownerID(c)
+	if err != nil {
+		return err
+	}
+	var b Budget
+	if err := c.Bind(&b); err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+	normalizeBudget(&b)
+	if errs := validateBudget(b); len(errs) > 0 {
+		return errorJSON(c, http.StatusUnprocessableEntity, validationErr(errs))
+	}
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	b, err = h.Store.CreateBudget(ctx, owner, b)
+	if err != nil {
+		return storeError(c, err)
+	}
+	return c.JSON(http.StatusCreated, b)
+}
+
+func (h *handler) GetBudgetsHandler(c echo.Context) error {
+	owner, err := ownerID(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	budgets, err := h.Store.ListBudgets(ctx, owner)
+	if err != nil {
+		return storeError(c, err)
+	}
+	return c.JSON(http.StatusOK, budgets)
+}
+
+func (h *handler) GetBudgetByIdHandler(c echo.Context) error {
+	owner, err := ownerID(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	b, err := h.Store.GetBudget(ctx, owner, id)
+	if err != nil {
+		return storeError(c, err)
+	}
+	return c.JSON(http.StatusOK, b)
+}
+
+func (h *handler) UpdateBudgetByIdHandler(c echo.Context) error {
+	owner, err := ownerID(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+	var b Budget
+	if err := c.Bind(&b); err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+	normalizeBudget(&b)
+	if errs := validateBudget(b); len(errs) > 0 {
+		return errorJSON(c, http.StatusUnprocessableEntity, validationErr(errs))
+	}
+	b.ID = id
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	b, err = h.Store.UpdateBudget(ctx, owner, b)
+	if err != nil {
+		return storeError(c, err)
+	}
+	return c.JSON(http.StatusOK, b)
+}
+
+func (h *handler) DeleteBudgetByIdHandler(c echo.Context) error {
+	owner, err := ownerID(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	if err := h.Store.DeleteBudget(ctx, owner, id); err != nil {
+		return storeError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetBudgetStatusHandler answers GET /budgets/:id/status with what has been
+// spent in the current period, or in the period containing ?on=2006-01-02.
+func (h *handler) GetBudgetStatusHandler(c echo.Context) error {
+	owner, err := ownerID(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+	on := time.Now()
+	if v := c.QueryParam("on"); v != "" {
+		if on, err = time.Parse(dateLayout, v); err != nil {
+			return errorJSON(c, http.StatusBadRequest, Err{Message: "on must be a date (2006-01-02)"})
+		}
+	}
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	b, err := h.Store.GetBudget(ctx, owner, id)
+	if err != nil {
+		return storeError(c, err)
+	}
+	start, end := periodRange(b.Period, on)
+	spent, err := budgetSpent(ctx, h.Store, owner, b, start, end)
+	if err != nil {
+		return storeError(c, err)
+	}
+
+	remaining := b.Amount - spent
+	if remaining < 0 {
+		remaining = 0
+	}
+	return c.JSON(http.StatusOK, BudgetStatus{
+		Budget:      b,
+		PeriodStart: start.Format(dateLayout),
+		PeriodEnd:   end.Format(dateLayout),
+		Spent:       spent,
+		Remaining:   remaining,
+		Percent:     percentOf(spent, b.Amount),
+		State:       budgetState(spent, b.Amount),
+	})
+}
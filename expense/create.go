@@ -2,26 +2,44 @@ package expense
 
 import (
 	"github.com/labstack/echo/v4"
-	"github.com/lib/pq"
 	"net/http"
+	"time"
 )
 
 func (h *handler) CreateExpensesHandler(c echo.Context) error {
 
+	owner, err := ownerID(c)
+	if err != nil {
+		return err
+	}
+
 	var ex Expense
-	err := c.Bind(&ex)
+	err = c.Bind(&ex)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, Err{Message: err.Error()})
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+
+	normalizeExpense(&ex)
+	if errs := validateExpense(ex); len(errs) > 0 {
+		return errorJSON(c, http.StatusUnprocessableEntity, validationErr(errs))
+	}
+
+	if ex.SpentAt == nil {
+		now := time.Now()
+		ex.SpentAt = &now
 	}
 
-	row := h.DB.QueryRow("INSERT INTO expenses(title, amount, note, tags) values($1, $2, $3, $4) RETURNING id", ex.Title, ex.Amount, ex.Note, pq.Array(ex.Tags))
-	err = row.Scan(&ex.ID)
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
 
+	ex, err = h.Store.Create(ctx, owner, ex)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, Err{Message: err.Error()})
+		return storeError(c, err)
 	}
+	countCreated(ex)
 
-	return c.JSON(http.StatusCreated, ex)
+	budgets := h.ownerBudgets(c, owner)
+	return c.JSON(http.StatusCreated, h.withBudgetAlerts(c, owner, budgets, ex, nil))
 
 }
 
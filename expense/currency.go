@@ -0,0 +1,55 @@
+package expense
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const DefaultCurrency = "THB"
+
+// currencies maps the ISO 4217 codes we accept to their number of minor
+// unit digits.
+var currencies = map[string]int{
+	"AUD": 2, "BND": 2, "CAD": 2, "CHF": 2, "CNY": 2, "DKK": 2, "EUR": 2,
+	"GBP": 2, "HKD": 2, "IDR": 2, "INR": 2, "JPY": 0, "KHR": 2, "KRW": 0,
+	"LAK": 2, "MMK": 2, "MYR": 2, "NOK": 2, "NZD": 2, "PHP": 2, "SEK": 2,
+	"SGD": 2, "THB": 2, "TWD": 2, "USD": 2, "VND": 0,
+}
+
+func normalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if _, ok := currencies[code]; !ok {
+		return "", fmt.Errorf("unsupported currency %q", code)
+	}
+	return code, nil
+}
+
+// fitsMinorUnits reports whether m has no more decimal places than digits.
+func fitsMinorUnits(m Money, digits int) bool {
+	step := Money(1)
+	for i := digits; i < MoneyScale; i++ {
+		step *= 10
+	}
+	return m%step == 0
+}
+
+// Convert multiplies m by rate and rounds half away from zero to the minor
+// units of the target currency.
+func (m Money) Convert(rate *big.Rat, currency string) (Money, error) {
+	r := new(big.Rat).Mul(m.Rat(), rate)
+
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(currencies[currency])), nil)
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(unit))
+
+	q, rem := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(scaled.Denom()) >= 0 {
+		if scaled.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+
+	return moneyFromRat(new(big.Rat).SetFrac(q, unit))
+}
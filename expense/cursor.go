@@ -0,0 +1,98 @@
+package expense
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/url"
+	"strconv"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+const HeaderNextCursor = "X-Next-Cursor"
+
+// cursor is the keyset position after which the next page starts: the sort
+// it was issued for and the sort values of the last row. It is handed to
+// clients as opaque base64 so its shape can change freely.
+type cursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+}
+
+func encodeCursor(cur cursor) string {
+	raw, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	var cur cursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	if err := json.Unmarshal(raw, &cur); err != nil || len(cur.Values) == 0 {
+		return nil, errInvalidCursor
+	}
+	return &cur, nil
+}
+
+type pageRequest struct {
+	Limit  int
+	After  *cursor
+	Paging bool
+}
+
+// parsePageRequest reads limit and cursor from the query string. Requests
+// without either keep the legacy bare array response of every row, and
+// Paging is false.
+func parsePageRequest(c echo.Context, maxSize int) (pageRequest, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxPageSize
+	}
+	p := pageRequest{Limit: maxSize}
+
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return p, fmt.Errorf("limit must be a positive integer")
+		}
+		if limit > maxSize {
+			limit = maxSize
+		}
+		p.Limit = limit
+		p.Paging = true
+	}
+
+	if v := c.QueryParam("cursor"); v != "" {
+		cur, err := decodeCursor(v)
+		if err != nil {
+			return p, err
+		}
+		p.After = cur
+		if !p.Paging && DefaultPageSize < maxSize {
+			p.Limit = DefaultPageSize
+		}
+		p.Paging = true
+	}
+
+	return p, nil
+}
+
+// setNextLink advertises the next page with an RFC 8288 Link header, and
+// its cursor with X-Next-Cursor.
+func setNextLink(c echo.Context, limit int, next string) {
+	c.Response().Header().Set(HeaderNextCursor, next)
+	u := url.URL{
+		Scheme: c.Scheme(),
+		Host:   c.Request().Host,
+		Path:   c.Request().URL.Path,
+	}
+	q := c.Request().URL.Query()
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set("cursor", next)
+	u.RawQuery = q.Encode()
+	c.Response().Header().Add("Link", fmt.Sprintf(`<%s>; rel="next"`, u.String()))
+}
@@ -1,37 +1,117 @@
 package expense
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	_ "github.com/lib/pq"
+	"github/anusornda/assessment/migrate"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
 	"log"
+	"strings"
+	"time"
 )
 
-func InitDB(dbUrl string) *handler {
-	var err error
+// MemoryURL selects the in-memory store. Anything after the scheme is the
+// path of a JSON snapshot, e.g. memory://expenses.json.
+const MemoryURL = "memory://"
 
-	db, err := sql.Open("postgres", dbUrl)
+// SQLiteURL selects the SQLite store, followed by the path of the database
+// file, e.g. sqlite://expenses.db.
+const SQLiteURL = "sqlite://"
 
+// OpenDB opens the SQL database behind dbUrl without touching its schema and
+// returns it with its migration dialect.
+func OpenDB(dbUrl string) (*sql.DB, string, error) {
+	if strings.HasPrefix(dbUrl, MemoryURL) {
+		return nil, "", fmt.Errorf("the memory store has no SQL database")
+	}
+	if strings.HasPrefix(dbUrl, SQLiteURL) {
+		db, err := openSQLite(strings.TrimPrefix(dbUrl, SQLiteURL))
+		return db, "sqlite", err
+	}
+	db, err := openTraced("postgres", dbUrl, semconv.DBSystemPostgreSQL)
+	return db, "postgres", err
+}
+
+// migrateUp brings the schema of db up to date.
+func migrateUp(db *sql.DB, dialect string) error {
+	m, err := migrate.New(db, dialect)
 	if err != nil {
-		log.Fatal("Connect to database error", err)
+		return err
+	}
+	_, err = m.Up()
+	return err
+}
+
+// sqlReady checks that db answers and has every migration applied.
+func sqlReady(ctx context.Context, db *sql.DB, dialect string) error {
+	if err := db.PingContext(ctx); err != nil {
+		return err
+	}
+	m, err := migrate.New(db, dialect)
+	if err != nil {
+		return err
+	}
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return err
 	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d migrations pending", len(pending))
+	}
+	return nil
+}
 
-	h := NewHandler(db)
+// sqlDB returns the SQL database behind store, or nil if it has none.
+func sqlDB(store Store) *sql.DB {
+	switch s := store.(type) {
+	case *PostgresStore:
+		return s.DB
+	case *SQLiteStore:
+		return s.DB
+	}
+	return nil
+}
+
+// ConfigurePool sizes the connection pool of the Postgres store; zero
+// maxOpen or maxLifetime mean no limit. The SQLite store keeps its single
+// connection.
+func (h *handler) ConfigurePool(maxOpen, maxIdle int, maxLifetime time.Duration) {
+	s, ok := h.Store.(*PostgresStore)
+	if !ok {
+		return
+	}
+	s.DB.SetMaxOpenConns(maxOpen)
+	s.DB.SetMaxIdleConns(maxIdle)
+	s.DB.SetConnMaxLifetime(maxLifetime)
+}
 
-	// defer db.Close()
+func InitDB(dbUrl string) *handler {
+	var err error
 
-	createTb := `CREATE TABLE IF NOT EXISTS expenses (
-		id SERIAL PRIMARY KEY,
-		title TEXT,
-		amount FLOAT,
-		note TEXT,
-		tags TEXT[]
-	);`
+	if strings.HasPrefix(dbUrl, MemoryURL) {
+		store := NewMemoryStore()
+		if path := strings.TrimPrefix(dbUrl, MemoryURL); path != "" {
+			if store, err = OpenMemoryStore(path); err != nil {
+				log.Fatal("can't load memory store snapshot ", err)
+			}
+		}
+		return NewHandler(store)
+	}
 
-	_, err = h.DB.Exec(createTb)
+	db, dialect, err := OpenDB(dbUrl)
 
 	if err != nil {
-		log.Fatal("can't create table", err)
+		log.Fatal("Connect to database error", err)
 	}
 
-	return h
+	if err := migrateUp(db, dialect); err != nil {
+		log.Fatal("can't migrate database ", err)
+	}
+
+	if dialect == "sqlite" {
+		return NewHandler(newSQLiteStore(db))
+	}
+	return NewHandler(NewPostgresStore(db))
 }
@@ -0,0 +1,68 @@
+package expense
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+)
+
+func (h *handler) DeleteExpensesByIdHandler(c echo.Context) error {
+
+	owner, err := ownerID(c)
+	if err != nil {
+		return err
+	}
+
+	rowID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	if err := h.Store.Delete(ctx, owner, rowID); err != nil {
+		return storeError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *handler) RestoreExpensesByIdHandler(c echo.Context) error {
+
+	owner, err := ownerID(c)
+	if err != nil {
+		return err
+	}
+
+	rowID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	ex, err := h.Store.Restore(ctx, owner, rowID)
+	if err != nil {
+		return storeError(c, err)
+	}
+	return c.JSON(http.StatusOK, ex)
+}
+
+func (h *handler) GetTrashExpensesHandler(c echo.Context) error {
+	owner, err := ownerID(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	expenses, err := h.Store.Trash(ctx, owner)
+	if err != nil {
+		return storeError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, expenses)
+}
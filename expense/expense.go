@@ -1,23 +1,107 @@
 package expense
 
-import "database/sql"
+import (
+	"context"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultPageSize    = 50
+	DefaultMaxPageSize = 100
+	DefaultDBTimeout   = 5 * time.Second
+)
 
 type handler struct {
-	DB *sql.DB
+	Store       Store
+	MaxPageSize int
+	// DBTimeout bounds the store calls of one request; zero means no limit.
+	DBTimeout time.Duration
+
+	shuttingDown atomic.Bool
+}
+
+func NewHandler(store Store) *handler {
+	return &handler{Store: store, MaxPageSize: DefaultMaxPageSize, DBTimeout: DefaultDBTimeout}
 }
 
-func NewHandler(db *sql.DB) *handler {
-	return &handler{db}
+// dbContext derives the context for store calls from the request, so they
+// stop once the client goes away, the server shuts down or DBTimeout passes.
+// The request carries the derived context so storeError can tell why a call
+// failed.
+func (h *handler) dbContext(c echo.Context) (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if h.DBTimeout > 0 {
+		ctx, cancel = context.WithTimeout(c.Request().Context(), h.DBTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(c.Request().Context())
+	}
+	c.SetRequest(c.Request().WithContext(ctx))
+	return ctx, cancel
 }
 
 type Expense struct {
-	ID     int      `json:"id""`
-	Title  string   `json:"title"`
-	Amount float64  `json:"amount"`
-	Note   string   `json:"note"`
-	Tags   []string `json:"tags"`
+	ID        int        `json:"id"`
+	Title     string     `json:"title"`
+	Amount    Money      `json:"amount"`
+	Currency  string     `json:"currency,omitempty"`
+	Note      string     `json:"note"`
+	Tags      []string   `json:"tags"`
+	SpentAt   *time.Time `json:"spent_at,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+
+	OriginalAmount   *Money `json:"original_amount,omitempty"`
+	OriginalCurrency string `json:"original_currency,omitempty"`
+}
+
+type Page struct {
+	Data       []Expense `json:"data"`
+	NextCursor string    `json:"next_cursor,omitempty"`
 }
 
 type Err struct {
-	Message string `json:"message"`
+	Message   string       `json:"message"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// errorJSON writes an error response carrying the request id, which clients
+// can quote when reporting a problem.
+func errorJSON(c echo.Context, code int, e Err) error {
+	e.RequestID = requestID(c)
+	return c.JSON(code, e)
+}
+
+// storeError maps errors returned by a Store to a response. Drivers report
+// cancelled queries in their own ways, so an ended request context wins.
+// Unexpected errors are logged and hidden from the client, as they may come
+// straight from the database.
+func storeError(c echo.Context, err error) error {
+	if ctxErr := c.Request().Context().Err(); ctxErr != nil {
+		err = ctxErr
+	}
+
+	var verr *ValidationError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		logger(c).Warn("database timeout")
+		return errorJSON(c, http.StatusGatewayTimeout, Err{Message: "database timeout"})
+	case errors.Is(err, context.Canceled):
+		return errorJSON(c, http.StatusServiceUnavailable, Err{Message: "request cancelled"})
+	case errors.Is(err, ErrNotFound):
+		return errorJSON(c, http.StatusNotFound, Err{Message: err.Error()})
+	case errors.As(err, &verr):
+		return errorJSON(c, http.StatusUnprocessableEntity, validationErr(verr.Errors))
+	case errors.Is(err, errNoRate):
+		return errorJSON(c, http.StatusUnprocessableEntity, Err{Message: err.Error()})
+	default:
+		logger(c).Error("store error", "error", err)
+		return errorJSON(c, http.StatusInternalServerError, Err{Message: internalErrorMessage})
+	}
 }
@@ -70,7 +70,7 @@ func TestITCreateExpenses(t *testing.T) {
 
 		expected := Expense{
 			Title:  "strawberry smoothie",
-			Amount: 79.0,
+			Amount: 7900,
 			Note:   "night market promotion discount 10 bath",
 			Tags:   []string{"food", "beverage"},
 		}
@@ -182,7 +182,7 @@ func TestUpdateExpensesById(t *testing.T) {
 	expected := Expense{
 		ID:     ex.ID,
 		Title:  "apple smoothie",
-		Amount: 89.0,
+		Amount: 8900,
 		Note:   "no discount",
 		Tags:   []string{"beverage"},
 	}
@@ -5,6 +5,9 @@ package expense
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/labstack/echo/v4"
 	"github.com/lib/pq"
@@ -14,8 +17,20 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
+var expenseTestColumns = []string{"id", "title", "amount", "currency", "note", "tags", "spent_at", "created_at", "updated_at"}
+
+var testTime = time.Date(2022, 12, 24, 10, 0, 0, 0, time.UTC)
+
+const testTimestamps = "\"spent_at\":\"2022-12-24T10:00:00Z\",\"created_at\":\"2022-12-24T10:00:00Z\",\"updated_at\":\"2022-12-24T10:00:00Z\""
+
+func withOwner(c echo.Context) echo.Context {
+	c.Set(principalKey, Principal{Subject: "alice", Method: "jwt"})
+	return c
+}
+
 func TestCreateExpenses(t *testing.T) {
 	// Arrange
 	body := bytes.NewBufferString(`{
@@ -31,7 +46,8 @@ func TestCreateExpenses(t *testing.T) {
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 
-		mockedRow := sqlmock.NewRows([]string{"id"}).AddRow(1)
+		mockedRow := sqlmock.NewRows(expenseTestColumns).
+			AddRow(1, "strawberry smoothie", 79, "THB", "night market promotion discount 10 bath", pq.Array([]string{"food", "beverage"}), testTime, testTime, testTime)
 
 		//db, mock, err := sqlmock.New()
 		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
@@ -39,17 +55,17 @@ func TestCreateExpenses(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		mock.ExpectQuery("INSERT INTO expenses(title, amount, note, tags) values($1, $2, $3, $4) RETURNING id").
-			WithArgs("strawberry smoothie", 79.0, "night market promotion discount 10 bath", pq.Array([]string{"food", "beverage"})).
+		mock.ExpectQuery("INSERT INTO expenses(title, amount, currency, note, tags, spent_at, owner_id) values($1, $2, $3, $4, $5, $6, $7) RETURNING id,title, amount, currency, note, tags, spent_at, created_at, updated_at").
+			WithArgs("strawberry smoothie", Money(7900), "THB", "night market promotion discount 10 bath", pq.Array([]string{"food", "beverage"}), sqlmock.AnyArg(), "alice").
 			WillReturnRows(mockedRow)
 
 		if err != nil {
 			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 		}
-		h := handler{db}
+		h := handler{Store: NewPostgresStore(db)}
 
-		c := e.NewContext(req, rec)
-		expected := "{\"id\":1,\"title\":\"strawberry smoothie\",\"amount\":79,\"note\":\"night market promotion discount 10 bath\",\"tags\":[\"food\",\"beverage\"]}"
+		c := withOwner(e.NewContext(req, rec))
+		expected := "{\"id\":1,\"title\":\"strawberry smoothie\",\"amount\":79,\"currency\":\"THB\",\"note\":\"night market promotion discount 10 bath\",\"tags\":[\"food\",\"beverage\"]," + testTimestamps + "}"
 
 		// Act
 		err = h.CreateExpensesHandler(c)
@@ -63,11 +79,17 @@ func TestCreateExpenses(t *testing.T) {
 
 	t.Run("Create Expenses fail", func(t *testing.T) {
 		e := echo.New()
-		req := httptest.NewRequest(http.MethodPost, "/", body)
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{
+			"title": "strawberry smoothie",
+			"amount": 79,
+			"note": "night market promotion discount 10 bath",
+			"tags": ["food", "beverage"]
+		}`))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 
-		mockedRow := sqlmock.NewRows([]string{"id"}).AddRow(1)
+		mockedRow := sqlmock.NewRows(expenseTestColumns).
+			AddRow(1, "strawberry smoothie", 79, "THB", "night market promotion discount 10 bath", pq.Array([]string{"food", "beverage"}), testTime, testTime, testTime)
 
 		//db, mock, err := sqlmock.New()
 		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
@@ -75,16 +97,16 @@ func TestCreateExpenses(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		mock.ExpectQuery("INSERT INTO expenses(title, amount, note, tags) values($1, $2, $3, $4) RETURNING id").
-			WithArgs("strawberry smoothie", 79.0, "night market promotion discount 10 bath", "[\"food\", \"beverage\"]").
+		mock.ExpectQuery("INSERT INTO expenses(title, amount, currency, note, tags, spent_at, owner_id) values($1, $2, $3, $4, $5, $6, $7) RETURNING id,title, amount, currency, note, tags, spent_at, created_at, updated_at").
+			WithArgs("strawberry smoothie", Money(7900), "THB", "night market promotion discount 10 bath", "[\"food\", \"beverage\"]", sqlmock.AnyArg(), "alice").
 			WillReturnRows(mockedRow)
 
 		if err != nil {
 			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 		}
-		h := handler{db}
+		h := handler{Store: NewPostgresStore(db)}
 
-		c := e.NewContext(req, rec)
+		c := withOwner(e.NewContext(req, rec))
 
 		// Act
 		err = h.CreateExpensesHandler(c)
@@ -95,6 +117,40 @@ func TestCreateExpenses(t *testing.T) {
 		}
 	})
 
+	t.Run("Create Expenses invalid", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{
+			"title": "  ",
+			"amount": -5,
+			"note": "",
+			"tags": ["food", "Food", ""]
+		}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+
+		db, _, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := handler{Store: NewPostgresStore(db)}
+
+		c := withOwner(e.NewContext(req, rec))
+		expected := `{"message":"validation failed","errors":[` +
+			`{"field":"title","code":"required","message":"title is required"},` +
+			`{"field":"amount","code":"min","message":"amount must be greater than zero"},` +
+			`{"field":"tags[1]","code":"duplicate","message":"tag \"Food\" is listed more than once"},` +
+			`{"field":"tags[2]","code":"required","message":"tag must not be empty"}]}`
+
+		// Act
+		err = h.CreateExpensesHandler(c)
+
+		// Assertions
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+			assert.JSONEq(t, expected, rec.Body.String())
+		}
+	})
+
 }
 
 func TestUpdateExpensesById(t *testing.T) {
@@ -120,7 +176,8 @@ func TestUpdateExpensesById(t *testing.T) {
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 
-		result := sqlmock.NewResult(1, 1)
+		updatedRow := sqlmock.NewRows(expenseTestColumns).
+			AddRow(1, "apple smoothie", 89, "THB", "no discount", pq.Array([]string{"beverage"}), testTime, testTime, testTime)
 
 		//db, mock, err := sqlmock.New()
 		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
@@ -128,20 +185,20 @@ func TestUpdateExpensesById(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		mock.ExpectPrepare("UPDATE expenses SET title=$2 , amount=$3, note=$4, tags=$5 WHERE id=$1;").
-			ExpectExec().
-			WithArgs(id, "apple smoothie", 89.0, "no discount", pq.Array([]string{"beverage"})).
-			WillReturnResult(result)
+		mock.ExpectPrepare("UPDATE expenses SET title=$2 , amount=$3, currency=$4, note=$5, tags=$6, spent_at=COALESCE($7, spent_at), updated_at=now() WHERE id=$1 AND owner_id=$8 AND deleted_at IS NULL RETURNING id,title, amount, currency, note, tags, spent_at, created_at, updated_at").
+			ExpectQuery().
+			WithArgs(id, "apple smoothie", Money(8900), "THB", "no discount", pq.Array([]string{"beverage"}), nil, "alice").
+			WillReturnRows(updatedRow)
 		if err != nil {
 			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 		}
-		h := handler{db}
+		h := handler{Store: NewPostgresStore(db)}
 
-		c := e.NewContext(req, rec)
+		c := withOwner(e.NewContext(req, rec))
 		c.SetPath("/:id")
 		c.SetParamNames("id")
 		c.SetParamValues(strconv.Itoa(id))
-		expected := "{\"id\":1,\"title\":\"apple smoothie\",\"amount\":89,\"note\":\"no discount\",\"tags\":[\"beverage\"]}"
+		expected := "{\"id\":1,\"title\":\"apple smoothie\",\"amount\":89,\"currency\":\"THB\",\"note\":\"no discount\",\"tags\":[\"beverage\"]," + testTimestamps + "}"
 
 		// Act
 		err = h.UpdateExpensesByIdHandler(c)
@@ -160,7 +217,8 @@ func TestUpdateExpensesById(t *testing.T) {
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 
-		result := sqlmock.NewResult(1, 1)
+		updatedRow := sqlmock.NewRows(expenseTestColumns).
+			AddRow(1, "apple smoothie", 89, "THB", "no discount", pq.Array([]string{"beverage"}), testTime, testTime, testTime)
 
 		//db, mock, err := sqlmock.New()
 		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
@@ -168,16 +226,16 @@ func TestUpdateExpensesById(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		mock.ExpectPrepare("UPDATE expenses SET title=$2 , amount=$3, note=$4, tags=$5 WHERE id=$1;").
-			ExpectExec().
-			WithArgs("id", "apple smoothie", 89.0, "no discount", pq.Array([]string{"beverage"})).
-			WillReturnResult(result)
+		mock.ExpectPrepare("UPDATE expenses SET title=$2 , amount=$3, currency=$4, note=$5, tags=$6, spent_at=COALESCE($7, spent_at), updated_at=now() WHERE id=$1 AND owner_id=$8 AND deleted_at IS NULL RETURNING id,title, amount, currency, note, tags, spent_at, created_at, updated_at").
+			ExpectQuery().
+			WithArgs("id", "apple smoothie", Money(8900), "THB", "no discount", pq.Array([]string{"beverage"}), nil, "alice").
+			WillReturnRows(updatedRow)
 		if err != nil {
 			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 		}
-		h := handler{db}
+		h := handler{Store: NewPostgresStore(db)}
 
-		c := e.NewContext(req, rec)
+		c := withOwner(e.NewContext(req, rec))
 		c.SetPath("/:id")
 		c.SetParamNames("id")
 		c.SetParamValues(strconv.Itoa(id))
@@ -198,7 +256,8 @@ func TestUpdateExpensesById(t *testing.T) {
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 
-		result := sqlmock.NewResult(1, 1)
+		updatedRow := sqlmock.NewRows(expenseTestColumns).
+			AddRow(1, "apple smoothie", 89, "THB", "no discount", pq.Array([]string{"beverage"}), testTime, testTime, testTime)
 
 		//db, mock, err := sqlmock.New()
 		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
@@ -206,16 +265,16 @@ func TestUpdateExpensesById(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		mock.ExpectPrepare("UPDATE expenses SET title=$2 , amount=$3, note=$4, tags=$5 WHERE id=$1;").
-			ExpectExec().
-			WithArgs("id", "apple smoothie", "no discount", pq.Array([]string{"beverage"})).
-			WillReturnResult(result)
+		mock.ExpectPrepare("UPDATE expenses SET title=$2 , amount=$3, currency=$4, note=$5, tags=$6, spent_at=COALESCE($7, spent_at), updated_at=now() WHERE id=$1 AND owner_id=$8 AND deleted_at IS NULL RETURNING id,title, amount, currency, note, tags, spent_at, created_at, updated_at").
+			ExpectQuery().
+			WithArgs("id", "apple smoothie", "no discount", pq.Array([]string{"beverage"}), nil, "alice").
+			WillReturnRows(updatedRow)
 		if err != nil {
 			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 		}
-		h := handler{db}
+		h := handler{Store: NewPostgresStore(db)}
 
-		c := e.NewContext(req, rec)
+		c := withOwner(e.NewContext(req, rec))
 		c.SetPath("/:id")
 		c.SetParamNames("id")
 		c.SetParamValues(strconv.Itoa(id))
@@ -225,7 +284,45 @@ func TestUpdateExpensesById(t *testing.T) {
 
 		// Assertions
 		if assert.NoError(t, err) {
-			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		}
+	})
+
+	t.Run("update deleted Expenses fail", func(t *testing.T) {
+		id := 1
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{
+			"title": "apple smoothie",
+			"amount": 89,
+			"note": "no discount",
+			"tags": ["beverage"]
+		}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mock.ExpectPrepare("UPDATE expenses SET title=$2 , amount=$3, currency=$4, note=$5, tags=$6, spent_at=COALESCE($7, spent_at), updated_at=now() WHERE id=$1 AND owner_id=$8 AND deleted_at IS NULL RETURNING id,title, amount, currency, note, tags, spent_at, created_at, updated_at").
+			ExpectQuery().
+			WithArgs(id, "apple smoothie", Money(8900), "THB", "no discount", pq.Array([]string{"beverage"}), nil, "alice").
+			WillReturnRows(sqlmock.NewRows(expenseTestColumns))
+		h := handler{Store: NewPostgresStore(db)}
+
+		c := withOwner(e.NewContext(req, rec))
+		c.SetPath("/:id")
+		c.SetParamNames("id")
+		c.SetParamValues(strconv.Itoa(id))
+
+		// Act
+		err = h.UpdateExpensesByIdHandler(c)
+
+		// Assertions
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusNotFound, rec.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
 		}
 	})
 
@@ -241,19 +338,54 @@ func TestGetAllExpenses(t *testing.T) {
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 
-		newsMockRows := sqlmock.NewRows([]string{"id", "title", "amount", "note", "tags"}).
-			AddRow(1, "apple smoothie", 89, "no discount", pq.Array([]string{"beverage"})).
-			AddRow(2, "iPhone 14 Pro Max 1TB", 66900, "birthday gift from my love", pq.Array([]string{"gadget"}))
+		newsMockRows := sqlmock.NewRows(expenseTestColumns).
+			AddRow(1, "apple smoothie", 89, "THB", "no discount", pq.Array([]string{"beverage"}), testTime, testTime, testTime).
+			AddRow(2, "iPhone 14 Pro Max 1TB", 66900, "THB", "birthday gift from my love", pq.Array([]string{"gadget"}), testTime, testTime, testTime)
 
 		db, mock, err := sqlmock.New()
-		mock.ExpectQuery("SELECT id,title, amount, note, tags FROM expenses").WillReturnRows(newsMockRows)
+		mock.ExpectQuery("SELECT id,title, amount, currency, note, tags, spent_at, created_at, updated_at FROM expenses").WillReturnRows(newsMockRows)
 		if err != nil {
 			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 		}
-		h := handler{db}
-		c := e.NewContext(req, rec)
-		expected := "[{\"id\":1,\"title\":\"apple smoothie\",\"amount\":89,\"note\":\"no discount\",\"tags\":[\"beverage\"]}," +
-			"{\"id\":2,\"title\":\"iPhone 14 Pro Max 1TB\",\"amount\":66900,\"note\":\"birthday gift from my love\",\"tags\":[\"gadget\"]}]"
+		h := handler{Store: NewPostgresStore(db)}
+		c := withOwner(e.NewContext(req, rec))
+		expected := "[{\"id\":1,\"title\":\"apple smoothie\",\"amount\":89,\"currency\":\"THB\",\"note\":\"no discount\",\"tags\":[\"beverage\"]," + testTimestamps + "}," +
+			"{\"id\":2,\"title\":\"iPhone 14 Pro Max 1TB\",\"amount\":66900,\"currency\":\"THB\",\"note\":\"birthday gift from my love\",\"tags\":[\"gadget\"]," + testTimestamps + "}]"
+
+		// Act
+		err = h.GetExpensesHandler(c)
+
+		// Assertions
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, expected, strings.TrimSpace(rec.Body.String()))
+		}
+	})
+
+	t.Run("get expenses page", func(t *testing.T) {
+		// Arrange
+
+		e := echo.New()
+		after := encodeCursor(cursor{Sort: "id", Values: []interface{}{1}})
+		req := httptest.NewRequest(http.MethodGet, "/expenses?limit=1&cursor="+after, nil)
+		rec := httptest.NewRecorder()
+
+		newsMockRows := sqlmock.NewRows(expenseTestColumns).
+			AddRow(2, "iPhone 14 Pro Max 1TB", 66900, "THB", "birthday gift from my love", pq.Array([]string{"gadget"}), testTime, testTime, testTime).
+			AddRow(3, "apple smoothie", 89, "THB", "no discount", pq.Array([]string{"beverage"}), testTime, testTime, testTime)
+
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mock.ExpectQuery("SELECT id,title, amount, currency, note, tags, spent_at, created_at, updated_at FROM expenses WHERE owner_id = $1 AND deleted_at IS NULL AND ((id > $2)) ORDER BY id ASC LIMIT $3").
+			WithArgs("alice", 1, 2).
+			WillReturnRows(newsMockRows)
+		h := handler{Store: NewPostgresStore(db), MaxPageSize: 10}
+		c := withOwner(e.NewContext(req, rec))
+		next := encodeCursor(cursor{Sort: "id", Values: []interface{}{2}})
+		expected := "{\"data\":[{\"id\":2,\"title\":\"iPhone 14 Pro Max 1TB\",\"amount\":66900,\"currency\":\"THB\",\"note\":\"birthday gift from my love\",\"tags\":[\"gadget\"]," + testTimestamps + "}]," +
+			"\"next_cursor\":\"" + next + "\"}"
 
 		// Act
 		err = h.GetExpensesHandler(c)
@@ -262,6 +394,129 @@ func TestGetAllExpenses(t *testing.T) {
 		if assert.NoError(t, err) {
 			assert.Equal(t, http.StatusOK, rec.Code)
 			assert.Equal(t, expected, strings.TrimSpace(rec.Body.String()))
+			assert.Equal(t, "<http://example.com/expenses?cursor="+next+"&limit=1>; rel=\"next\"", rec.Header().Get("Link"))
+		}
+	})
+
+	t.Run("get expenses without paging returns every expense", func(t *testing.T) {
+		store := NewMemoryStore()
+		for i := 1; i <= 5; i++ {
+			_, err := store.Create(context.Background(), "alice", Expense{Title: fmt.Sprint("coffee ", i), Amount: 6000, Currency: "THB"})
+			assert.NoError(t, err)
+		}
+		h := handler{Store: store, MaxPageSize: 3}
+
+		rec := httptest.NewRecorder()
+		c := withOwner(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/expenses", nil), rec))
+		assert.NoError(t, h.GetExpensesHandler(c))
+		var all []Expense
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &all))
+		assert.Len(t, all, 5)
+		assert.Empty(t, rec.Header().Get(HeaderNextCursor))
+		assert.Empty(t, rec.Header().Get("Link"))
+
+		rec = httptest.NewRecorder()
+		c = withOwner(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/expenses?limit=10", nil), rec))
+		assert.NoError(t, h.GetExpensesHandler(c))
+		var page Page
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+		assert.Len(t, page.Data, 3)
+		assert.NotEmpty(t, page.NextCursor)
+	})
+
+	t.Run("get expenses filtered and sorted", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/expenses?tag=food&tag_match=all&min_amount=500&title=50%25&created_from=2022-12-01&created_to=2022-12-31&sort=-amount", nil)
+		rec := httptest.NewRecorder()
+
+		newsMockRows := sqlmock.NewRows(expenseTestColumns).
+			AddRow(4, "buffet 50% off", 899, "THB", "", pq.Array([]string{"food"}), testTime, testTime, testTime)
+
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mock.ExpectQuery("SELECT id,title, amount, currency, note, tags, spent_at, created_at, updated_at FROM expenses WHERE owner_id = $1 AND deleted_at IS NULL AND tags @> $2 AND amount >= $3 AND title ILIKE '%' || $4 || '%' AND created_at >= $5 AND created_at < $6 ORDER BY amount DESC, id ASC").
+			WithArgs("alice", pq.Array([]string{"food"}), Money(50000), `50\%`,
+				time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)).
+			WillReturnRows(newsMockRows)
+		h := handler{Store: NewPostgresStore(db), MaxPageSize: 10}
+		c := withOwner(e.NewContext(req, rec))
+		expected := "[{\"id\":4,\"title\":\"buffet 50% off\",\"amount\":899,\"currency\":\"THB\",\"note\":\"\",\"tags\":[\"food\"]," + testTimestamps + "}]"
+
+		// Act
+		err = h.GetExpensesHandler(c)
+
+		// Assertions
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, expected, strings.TrimSpace(rec.Body.String()))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		}
+	})
+
+	t.Run("get expenses unknown sort field", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/expenses?sort=password", nil)
+		rec := httptest.NewRecorder()
+
+		db, _, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := handler{Store: NewPostgresStore(db), MaxPageSize: 10}
+		c := withOwner(e.NewContext(req, rec))
+
+		// Act
+		err = h.GetExpensesHandler(c)
+
+		// Assertions
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		}
+	})
+
+	t.Run("get expenses invalid cursor", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/expenses?cursor=!!", nil)
+		rec := httptest.NewRecorder()
+
+		db, _, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := handler{Store: NewPostgresStore(db), MaxPageSize: 10}
+		c := withOwner(e.NewContext(req, rec))
+
+		// Act
+		err = h.GetExpensesHandler(c)
+
+		// Assertions
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		}
+	})
+
+	t.Run("get expense by invalid id", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/expenses/abc", nil)
+		rec := httptest.NewRecorder()
+
+		db, _, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := handler{Store: NewPostgresStore(db)}
+		c := withOwner(e.NewContext(req, rec))
+		c.SetParamNames("id")
+		c.SetParamValues("abc")
+
+		// Act
+		err = h.GetExpensesByIdHandler(c)
+
+		// Assertions
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
 		}
 	})
 
@@ -272,8 +527,8 @@ func TestGetAllExpenses(t *testing.T) {
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 
-		newsMockRows := sqlmock.NewRows([]string{"id", "title", "amount", "note", "tags"}).
-			AddRow(1, "strawberry smoothie", 79, "night market promotion discount 10 bath", pq.Array([]string{"food", "beverage"}))
+		newsMockRows := sqlmock.NewRows(expenseTestColumns).
+			AddRow(1, "strawberry smoothie", 79, "THB", "night market promotion discount 10 bath", pq.Array([]string{"food", "beverage"}), testTime, testTime, testTime)
 
 		//db, mock, err := sqlmock.New()
 		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
@@ -281,19 +536,19 @@ func TestGetAllExpenses(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		mock.ExpectQuery("SELECT id,title, amount, note, tags FROM expenses WHERE id=$1").
-			WithArgs(strconv.Itoa(id)).
+		mock.ExpectQuery("SELECT id,title, amount, currency, note, tags, spent_at, created_at, updated_at FROM expenses WHERE id=$1 AND owner_id=$2 AND deleted_at IS NULL").
+			WithArgs(id, "alice").
 			WillReturnRows(newsMockRows)
 		if err != nil {
 			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 		}
-		h := handler{db}
+		h := handler{Store: NewPostgresStore(db)}
 
-		c := e.NewContext(req, rec)
+		c := withOwner(e.NewContext(req, rec))
 		c.SetPath("/:id")
 		c.SetParamNames("id")
 		c.SetParamValues(strconv.Itoa(id))
-		expected := "{\"id\":1,\"title\":\"strawberry smoothie\",\"amount\":79,\"note\":\"night market promotion discount 10 bath\",\"tags\":[\"food\",\"beverage\"]}"
+		expected := "{\"id\":1,\"title\":\"strawberry smoothie\",\"amount\":79,\"currency\":\"THB\",\"note\":\"night market promotion discount 10 bath\",\"tags\":[\"food\",\"beverage\"]," + testTimestamps + "}"
 
 		// Act
 		err = h.GetExpensesByIdHandler(c)
@@ -307,6 +562,188 @@ func TestGetAllExpenses(t *testing.T) {
 	})
 }
 
+func TestDeleteExpensesById(t *testing.T) {
+
+	t.Run("delete expense success", func(t *testing.T) {
+		id := 1
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodDelete, "/", nil)
+		rec := httptest.NewRecorder()
+
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mock.ExpectExec("UPDATE expenses SET deleted_at=now() WHERE id=$1 AND owner_id=$2 AND deleted_at IS NULL").
+			WithArgs(id, "alice").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		h := handler{Store: NewPostgresStore(db)}
+
+		c := withOwner(e.NewContext(req, rec))
+		c.SetPath("/:id")
+		c.SetParamNames("id")
+		c.SetParamValues(strconv.Itoa(id))
+
+		// Act
+		err = h.DeleteExpensesByIdHandler(c)
+
+		// Assertions
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusNoContent, rec.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		}
+	})
+
+	t.Run("delete expense not found", func(t *testing.T) {
+		id := 99
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodDelete, "/", nil)
+		rec := httptest.NewRecorder()
+
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mock.ExpectExec("UPDATE expenses SET deleted_at=now() WHERE id=$1 AND owner_id=$2 AND deleted_at IS NULL").
+			WithArgs(id, "alice").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		h := handler{Store: NewPostgresStore(db)}
+
+		c := withOwner(e.NewContext(req, rec))
+		c.SetPath("/:id")
+		c.SetParamNames("id")
+		c.SetParamValues(strconv.Itoa(id))
+
+		// Act
+		err = h.DeleteExpensesByIdHandler(c)
+
+		// Assertions
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusNotFound, rec.Code)
+		}
+	})
+
+	t.Run("restore expense success", func(t *testing.T) {
+		id := 1
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		rec := httptest.NewRecorder()
+
+		mockedRow := sqlmock.NewRows(expenseTestColumns).
+			AddRow(1, "apple smoothie", 89, "THB", "no discount", pq.Array([]string{"beverage"}), testTime, testTime, testTime)
+
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mock.ExpectQuery("UPDATE expenses SET deleted_at=NULL, updated_at=now() WHERE id=$1 AND owner_id=$2 AND deleted_at IS NOT NULL RETURNING id,title, amount, currency, note, tags, spent_at, created_at, updated_at").
+			WithArgs(id, "alice").
+			WillReturnRows(mockedRow)
+		h := handler{Store: NewPostgresStore(db)}
+
+		c := withOwner(e.NewContext(req, rec))
+		c.SetPath("/:id/restore")
+		c.SetParamNames("id")
+		c.SetParamValues(strconv.Itoa(id))
+		expected := "{\"id\":1,\"title\":\"apple smoothie\",\"amount\":89,\"currency\":\"THB\",\"note\":\"no discount\",\"tags\":[\"beverage\"]," + testTimestamps + "}"
+
+		// Act
+		err = h.RestoreExpensesByIdHandler(c)
+
+		// Assertions
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, expected, strings.TrimSpace(rec.Body.String()))
+		}
+	})
+
+	t.Run("get trash expenses", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+
+		deletedAt := time.Date(2022, 12, 24, 10, 0, 0, 0, time.UTC)
+		mockedRows := sqlmock.NewRows(append(expenseTestColumns, "deleted_at")).
+			AddRow(2, "iPhone 14 Pro Max 1TB", 66900, "THB", "birthday gift from my love", pq.Array([]string{"gadget"}), testTime, testTime, testTime, deletedAt)
+
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mock.ExpectQuery("SELECT id,title, amount, currency, note, tags, spent_at, created_at, updated_at, deleted_at FROM expenses WHERE owner_id=$1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC").
+			WithArgs("alice").
+			WillReturnRows(mockedRows)
+		h := handler{Store: NewPostgresStore(db)}
+
+		c := withOwner(e.NewContext(req, rec))
+		expected := "[{\"id\":2,\"title\":\"iPhone 14 Pro Max 1TB\",\"amount\":66900,\"currency\":\"THB\",\"note\":\"birthday gift from my love\",\"tags\":[\"gadget\"]," + testTimestamps + ",\"deleted_at\":\"2022-12-24T10:00:00Z\"}]"
+
+		// Act
+		err = h.GetTrashExpensesHandler(c)
+
+		// Assertions
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, expected, strings.TrimSpace(rec.Body.String()))
+		}
+	})
+}
+
+func TestExpenseOwnership(t *testing.T) {
+
+	t.Run("other owner's expense is not found", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mock.ExpectQuery("SELECT id,title, amount, currency, note, tags, spent_at, created_at, updated_at FROM expenses WHERE id=$1 AND owner_id=$2 AND deleted_at IS NULL").
+			WithArgs(7, "alice").
+			WillReturnRows(sqlmock.NewRows(expenseTestColumns))
+		h := handler{Store: NewPostgresStore(db)}
+
+		c := withOwner(e.NewContext(req, rec))
+		c.SetPath("/:id")
+		c.SetParamNames("id")
+		c.SetParamValues("7")
+
+		// Act
+		err = h.GetExpensesByIdHandler(c)
+
+		// Assertions
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusNotFound, rec.Code)
+		}
+	})
+
+	t.Run("request without principal is unauthorized", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+
+		db, _, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := handler{Store: NewPostgresStore(db)}
+
+		c := e.NewContext(req, rec)
+
+		// Act
+		err = h.GetExpensesHandler(c)
+
+		// Assertions
+		assert.Equal(t, echo.ErrUnauthorized, err)
+	})
+}
+
 func TestCheckAuthorization(t *testing.T) {
 
 	t.Run("check authorization success", func(t *testing.T) {
@@ -340,3 +777,56 @@ func TestCheckAuthorization(t *testing.T) {
 	})
 
 }
+
+func TestDatabaseTimeout(t *testing.T) {
+	t.Run("slow query times out with 504", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/expenses/1", nil)
+		rec := httptest.NewRecorder()
+
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mock.ExpectQuery("SELECT id,title, amount, currency, note, tags, spent_at, created_at, updated_at FROM expenses WHERE id=$1 AND owner_id=$2 AND deleted_at IS NULL").
+			WithArgs(1, "alice").
+			WillDelayFor(time.Second).
+			WillReturnRows(sqlmock.NewRows(expenseTestColumns))
+		h := handler{Store: NewPostgresStore(db), DBTimeout: 10 * time.Millisecond}
+		c := withOwner(e.NewContext(req, rec))
+		c.SetPath("/expenses/:id")
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		err = h.GetExpensesByIdHandler(c)
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+			assert.Equal(t, "{\"message\":\"database timeout\"}", strings.TrimSpace(rec.Body.String()))
+		}
+	})
+
+	t.Run("cancelled request returns 503", func(t *testing.T) {
+		e := echo.New()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req := httptest.NewRequest(http.MethodGet, "/expenses/1", nil).WithContext(ctx)
+		rec := httptest.NewRecorder()
+
+		db, _, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := handler{Store: NewPostgresStore(db)}
+		c := withOwner(e.NewContext(req, rec))
+		c.SetPath("/expenses/:id")
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		err = h.GetExpensesByIdHandler(c)
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		}
+	})
+}
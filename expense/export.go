@@ -0,0 +1,225 @@
+package expense
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ExportCSV    = "csv"
+	ExportNDJSON = "ndjson"
+	ExportXLSX   = "xlsx"
+)
+
+var exportColumns = []string{"id", "title", "amount", "currency", "note", "tags", "spent_at", "created_at", "updated_at"}
+
+// exportWriter encodes expenses one at a time; Close finishes the file.
+type exportWriter interface {
+	Write(ex Expense) error
+	Close() error
+}
+
+var exportFormats = map[string]struct {
+	contentType string
+	open        func(w io.Writer) (exportWriter, error)
+}{
+	ExportCSV:    {"text/csv; charset=utf-8", newCSVExport},
+	ExportNDJSON: {"application/x-ndjson", newNDJSONExport},
+	ExportXLSX:   {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", newXLSXExport},
+}
+
+func exportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// exportRecord is ex as the text of exportColumns. Tags are separated by
+// semicolons, as POST /expenses/import reads them by default.
+func exportRecord(ex Expense) []string {
+	return []string{
+		strconv.Itoa(ex.ID), ex.Title, ex.Amount.String(), ex.Currency, ex.Note, strings.Join(ex.Tags, ";"),
+		exportTime(ex.SpentAt), exportTime(ex.CreatedAt), exportTime(ex.UpdatedAt),
+	}
+}
+
+type csvExport struct {
+	w *csv.Writer
+}
+
+func newCSVExport(w io.Writer) (exportWriter, error) {
+	cw := csv.NewWriter(w)
+	return csvExport{cw}, cw.Write(exportColumns)
+}
+
+// Write keeps spreadsheets from running free text as formulas.
+func (e csvExport) Write(ex Expense) error {
+	record := exportRecord(ex)
+	for _, i := range []int{1, 4, 5} {
+		if v := record[i]; v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			record[i] = "'" + v
+		}
+	}
+	return e.w.Write(record)
+}
+
+func (e csvExport) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonExport struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONExport(w io.Writer) (exportWriter, error) {
+	bw := bufio.NewWriter(w)
+	return ndjsonExport{bw, json.NewEncoder(bw)}, nil
+}
+
+func (e ndjsonExport) Write(ex Expense) error {
+	return e.enc.Encode(ex)
+}
+
+func (e ndjsonExport) Close() error {
+	return e.w.Flush()
+}
+
+// xlsxExport writes the smallest workbook spreadsheets open: one sheet of
+// inline strings and numbers, zipped as it is written.
+type xlsxExport struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+}
+
+var xlsxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Expenses" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+func newXLSXExport(w io.Writer) (exportWriter, error) {
+	zw := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	// The sheet is the last part, so it can stay open while rows arrive.
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	e := xlsxExport{zw: zw, sheet: bufio.NewWriter(f)}
+	e.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return e, e.row(exportColumns, nil)
+}
+
+// row writes a row of inline strings, except for the columns in numbers.
+func (e xlsxExport) row(values []string, numbers map[int]bool) error {
+	e.sheet.WriteString("<row>")
+	for i, v := range values {
+		if numbers[i] {
+			fmt.Fprintf(e.sheet, "<c><v>%s</v></c>", v)
+			continue
+		}
+		e.sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+		if err := xml.EscapeText(e.sheet, []byte(v)); err != nil {
+			return err
+		}
+		e.sheet.WriteString("</t></is></c>")
+	}
+	_, err := e.sheet.WriteString("</row>")
+	return err
+}
+
+var xlsxNumbers = map[int]bool{0: true, 2: true}
+
+func (e xlsxExport) Write(ex Expense) error {
+	return e.row(exportRecord(ex), xlsxNumbers)
+}
+
+func (e xlsxExport) Close() error {
+	e.sheet.WriteString("</sheetData></worksheet>")
+	if err := e.sheet.Flush(); err != nil {
+		return err
+	}
+	return e.zw.Close()
+}
+
+// ExportExpensesHandler answers GET /expenses/export?format=csv|ndjson|xlsx
+// with every expense matching the filters and sort of GetExpensesHandler.
+// Rows are written as the store reads them, so memory use does not grow
+// with the export. Exports are not bound by the database timeout of other
+// requests, as they may take a while.
+func (h *handler) ExportExpensesHandler(c echo.Context) error {
+	owner, err := ownerID(c)
+	if err != nil {
+		return err
+	}
+	q, err := parseListFilter(c)
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+	if q.Sort, err = parseSort(c.QueryParam("sort")); err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+	q.OwnerID = owner
+
+	name := c.QueryParam("format")
+	if name == "" {
+		name = ExportCSV
+	}
+	format, ok := exportFormats[name]
+	if !ok {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: "format must be csv, ndjson or xlsx"})
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, format.contentType)
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="expenses.%s"`, name))
+
+	w, err := format.open(res)
+	if err == nil {
+		err = h.Store.Export(c.Request().Context(), q, w.Write)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err == nil {
+		return nil
+	}
+
+	// Until the first buffered rows are sent the error can still be
+	// reported; after that, the connection is cut so that the client does
+	// not take a truncated file for a whole one.
+	if !res.Committed {
+		res.Header().Del(echo.HeaderContentDisposition)
+		return storeError(c, err)
+	}
+	logger(c).Error("export failed", "error", err)
+	panic(http.ErrAbortHandler)
+}
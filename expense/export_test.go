@@ -0,0 +1,142 @@
+//go:build unit
+// +build unit
+
+package expense
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func exportExpenses(t *testing.T, h *handler, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/expenses/export?"+query, nil)
+	rec := httptest.NewRecorder()
+	c := withOwner(echo.New().NewContext(req, rec))
+	if err := h.ExportExpensesHandler(c); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func exportStore(t *testing.T) *MemoryStore {
+	store := NewMemoryStore()
+	for _, ex := range []Expense{
+		{Title: "rent", Amount: 1200000, Currency: "THB", Tags: []string{"home"}, SpentAt: &testTime},
+		{Title: "=HYPERLINK(\"x\")", Amount: 12345, Currency: "THB", Note: "a < b & c", Tags: []string{"food", "lunch"}, SpentAt: &testTime},
+		{Title: "coffee", Amount: 9000, Currency: "THB", Tags: []string{"food"}, SpentAt: &testTime},
+	} {
+		_, err := store.Create(context.Background(), "alice", ex)
+		assert.NoError(t, err)
+	}
+	_, err := store.Create(context.Background(), "bob", Expense{Title: "bread", Amount: 5000, Currency: "THB", Tags: []string{"food"}, SpentAt: &testTime})
+	assert.NoError(t, err)
+	return store
+}
+
+func TestExportExpenses(t *testing.T) {
+	h := NewHandler(exportStore(t))
+
+	t.Run("csv is the default and uses the list filters", func(t *testing.T) {
+		rec := exportExpenses(t, h, "tag=food&sort=-amount")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, `attachment; filename="expenses.csv"`, rec.Header().Get(echo.HeaderContentDisposition))
+		records, err := csv.NewReader(rec.Body).ReadAll()
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{
+			exportColumns,
+			{"2", `'=HYPERLINK("x")`, "123.45", "THB", "a < b & c", "food;lunch", "2022-12-24T10:00:00Z"},
+			{"3", "coffee", "90", "THB", "", "food", "2022-12-24T10:00:00Z"},
+		}, trimTimestamps(records))
+	})
+
+	t.Run("ndjson writes an expense per line", func(t *testing.T) {
+		rec := exportExpenses(t, h, "format=ndjson&title=coffee")
+
+		assert.Equal(t, "application/x-ndjson", rec.Header().Get(echo.HeaderContentType))
+		lines := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n")
+		if assert.Len(t, lines, 1) {
+			assert.Contains(t, lines[0], `"title":"coffee","amount":90,"currency":"THB"`)
+		}
+	})
+
+	t.Run("xlsx holds a sheet of the rows", func(t *testing.T) {
+		rec := exportExpenses(t, h, "format=xlsx&sort=id")
+
+		assert.Equal(t, `attachment; filename="expenses.xlsx"`, rec.Header().Get(echo.HeaderContentDisposition))
+		zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+		if !assert.NoError(t, err) {
+			return
+		}
+		names := []string{}
+		var sheet string
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+			if f.Name == "xl/worksheets/sheet1.xml" {
+				r, _ := f.Open()
+				b, _ := io.ReadAll(r)
+				sheet = string(b)
+			}
+		}
+		assert.Equal(t, []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"}, names)
+		assert.Equal(t, 4, strings.Count(sheet, "<row>"))
+		assert.Contains(t, sheet, `<c><v>2</v></c><c t="inlineStr"><is><t xml:space="preserve">=HYPERLINK(&#34;x&#34;)</t></is></c><c><v>123.45</v></c>`)
+		assert.Contains(t, sheet, `a &lt; b &amp; c`)
+		assert.NotContains(t, sheet, "bread")
+	})
+
+	t.Run("unknown formats are rejected", func(t *testing.T) {
+		rec := exportExpenses(t, h, "format=pdf")
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Empty(t, rec.Header().Get(echo.HeaderContentDisposition))
+	})
+}
+
+// trimTimestamps drops created_at and updated_at, which are set by the store.
+func trimTimestamps(records [][]string) [][]string {
+	for i, r := range records[1:] {
+		records[i+1] = r[:7]
+	}
+	return records
+}
+
+type failingExportStore struct {
+	*MemoryStore
+	after int
+}
+
+func (s failingExportStore) Export(ctx context.Context, q ListQuery, fn func(Expense) error) error {
+	for i := 0; i < s.after; i++ {
+		if err := fn(Expense{ID: i + 1, Title: strings.Repeat("x", 1024)}); err != nil {
+			return err
+		}
+	}
+	return errors.New("connection reset")
+}
+
+func TestExportExpensesFailure(t *testing.T) {
+	t.Run("errors before any row is sent are reported", func(t *testing.T) {
+		rec := exportExpenses(t, NewHandler(failingExportStore{NewMemoryStore(), 0}), "")
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Empty(t, rec.Header().Get(echo.HeaderContentDisposition))
+	})
+
+	t.Run("errors after rows are sent abort the response", func(t *testing.T) {
+		assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			exportExpenses(t, NewHandler(failingExportStore{NewMemoryStore(), 100}), "")
+		})
+	})
+}
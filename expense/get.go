@@ -1,48 +1,106 @@
 package expense
 
 import (
-	"database/sql"
 	"github.com/labstack/echo/v4"
-	"github.com/lib/pq"
 	"net/http"
+	"strconv"
 )
 
 func (h *handler) GetExpensesHandler(c echo.Context) error {
-	rows, err := h.DB.Query("SELECT id,title, amount, note, tags FROM expenses")
+	owner, err := ownerID(c)
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
+	q, paging, err := parseListQuery(c, h.MaxPageSize)
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+	q.OwnerID = owner
+	currency, err := convertParam(c)
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
 
-	var expense []Expense
-	for rows.Next() {
-		var ex Expense
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
 
-		err := rows.Scan(&ex.ID, &ex.Title, &ex.Amount, &ex.Note, pq.Array(&ex.Tags))
+	var expense []Expense
+	var next string
+	if paging {
+		// One extra row tells us whether another page exists.
+		fetch := q
+		fetch.Limit++
+		expense, err = h.Store.List(ctx, fetch)
+		if err == nil && len(expense) > q.Limit {
+			expense = expense[:q.Limit]
+			next = encodeCursor(q.cursorFor(expense[len(expense)-1]))
+			setNextLink(c, q.Limit, next)
+		}
+	} else {
+		// Clients that do not page get the whole list, as they always have.
+		expense = []Expense{}
+		err = h.Store.Export(ctx, q, func(ex Expense) error {
+			expense = append(expense, ex)
+			return nil
+		})
+	}
+	if err == errInvalidCursor {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+	if err != nil {
+		return storeError(c, err)
+	}
 
+	if currency != "" {
+		rates, err := h.loadRates(ctx, currency)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, Err{Message: err.Error()})
+			return storeError(c, err)
+		}
+		for i := range expense {
+			if err := convertExpense(&expense[i], rates); err != nil {
+				return storeError(c, err)
+			}
 		}
-
-		expense = append(expense, ex)
 	}
 
-	return c.JSON(http.StatusOK, expense)
+	if !paging {
+		return c.JSON(http.StatusOK, expense)
+	}
+	return c.JSON(http.StatusOK, Page{Data: expense, NextCursor: next})
 }
 
 func (h *handler) GetExpensesByIdHandler(c echo.Context) error {
+	owner, err := ownerID(c)
+	if err != nil {
+		return err
+	}
+	currency, err := convertParam(c)
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
 
-	row := h.DB.QueryRow("SELECT id,title, amount, note, tags FROM expenses WHERE id=$1", c.Param("id"))
-	ex := Expense{}
-	err := row.Scan(&ex.ID, &ex.Title, &ex.Amount, &ex.Note, pq.Array(&ex.Tags))
+	ex, err := h.Store.Get(ctx, owner, id)
+	if err != nil {
+		return storeError(c, err)
+	}
 
-	switch err {
-	case sql.ErrNoRows:
-		return c.JSON(http.StatusNotFound, Err{Message: "expense not found"})
-	case nil:
-		return c.JSON(http.StatusOK, ex)
-	default:
-		return c.JSON(http.StatusInternalServerError, Err{Message: err.Error()})
+	if currency != "" {
+		rates, err := h.loadRates(ctx, currency)
+		if err != nil {
+			return storeError(c, err)
+		}
+		if err := convertExpense(&ex, rates); err != nil {
+			return storeError(c, err)
+		}
 	}
+	return c.JSON(http.StatusOK, ex)
 
 }
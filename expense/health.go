@@ -0,0 +1,40 @@
+package expense
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type Status struct {
+	Status string `json:"status"`
+}
+
+// BeginShutdown makes ReadyzHandler fail from now on, so load balancers stop
+// routing new requests while the server drains.
+func (h *handler) BeginShutdown() {
+	h.shuttingDown.Store(true)
+}
+
+// HealthzHandler reports that the process is alive. It checks nothing else,
+// so an unreachable database never gets the process restarted.
+func (h *handler) HealthzHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, Status{Status: "ok"})
+}
+
+// ReadyzHandler reports whether the server should receive traffic: it is
+// not shutting down and its store is reachable and fully migrated. Why the
+// store is not ready is only logged, since the probe needs no credentials.
+func (h *handler) ReadyzHandler(c echo.Context) error {
+	if h.shuttingDown.Load() {
+		return errorJSON(c, http.StatusServiceUnavailable, Err{Message: "shutting down"})
+	}
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	if err := h.Store.Ready(ctx); err != nil {
+		logger(c).Warn("store not ready", "error", err)
+		return errorJSON(c, http.StatusServiceUnavailable, Err{Message: "not ready"})
+	}
+	return c.JSON(http.StatusOK, Status{Status: "ready"})
+}
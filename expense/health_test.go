@@ -0,0 +1,82 @@
+//go:build unit
+// +build unit
+
+package expense
+
+import (
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func probe(h *handler, handle func(*handler, echo.Context) error) *httptest.ResponseRecorder {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	handle(h, e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec))
+	return rec
+}
+
+func TestProbes(t *testing.T) {
+	t.Run("healthz is always ok", func(t *testing.T) {
+		h := NewHandler(NewMemoryStore())
+		h.BeginShutdown()
+
+		rec := probe(h, (*handler).HealthzHandler)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `{"status":"ok"}`, strings.TrimSpace(rec.Body.String()))
+	})
+
+	t.Run("readyz fails once shutdown begins", func(t *testing.T) {
+		h := NewHandler(NewMemoryStore())
+
+		rec := probe(h, (*handler).ReadyzHandler)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `{"status":"ready"}`, strings.TrimSpace(rec.Body.String()))
+
+		h.BeginShutdown()
+		rec = probe(h, (*handler).ReadyzHandler)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Equal(t, `{"message":"shutting down"}`, strings.TrimSpace(rec.Body.String()))
+	})
+
+	t.Run("readyz fails when the database is unreachable", func(t *testing.T) {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		h := NewHandler(NewPostgresStore(db))
+
+		rec := httptest.NewRecorder()
+		c, logs := withLogs(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec))
+		h.ReadyzHandler(c)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Equal(t, `{"message":"not ready"}`, strings.TrimSpace(rec.Body.String()))
+		assert.Contains(t, logs.String(), `"error":"connection refused"`)
+	})
+
+	t.Run("readyz fails while migrations are pending", func(t *testing.T) {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mock.ExpectPing()
+		mock.ExpectQuery("SELECT version FROM schema_migrations").
+			WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+		h := NewHandler(NewPostgresStore(db))
+
+		rec := httptest.NewRecorder()
+		c, logs := withLogs(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec))
+		h.ReadyzHandler(c)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Contains(t, logs.String(), "migrations pending")
+	})
+}
@@ -0,0 +1,449 @@
+package expense
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const maxImportRows = 5000
+
+const (
+	ImportValid    = "valid"
+	ImportInvalid  = "invalid"
+	ImportImported = "imported"
+)
+
+// importFields are the Expense fields a CSV column can be mapped to.
+var importFields = []string{"title", "amount", "currency", "note", "tags", "spent_at"}
+
+// ImportOptions says how to read a CSV export. Columns maps expense fields
+// to header names, or to 1-based positions when the file has no header.
+type ImportOptions struct {
+	Columns      map[string]string
+	Header       bool
+	Delimiter    rune
+	DateLayout   string
+	Decimal      string
+	TagSeparator string
+	DryRun       bool
+	SkipInvalid  bool
+}
+
+// ImportRow is the outcome of one CSV line.
+type ImportRow struct {
+	Line    int          `json:"line"`
+	Status  string       `json:"status"`
+	Expense *Expense     `json:"expense,omitempty"`
+	Errors  []FieldError `json:"errors,omitempty"`
+}
+
+type ImportReport struct {
+	DryRun   bool        `json:"dry_run"`
+	Total    int         `json:"total"`
+	Valid    int         `json:"valid"`
+	Invalid  int         `json:"invalid"`
+	Imported int         `json:"imported"`
+	Rows     []ImportRow `json:"rows"`
+}
+
+// dateTokens are the parts of a date_format and their time layouts.
+var dateTokens = map[string]string{
+	"YYYY": "2006", "YY": "06",
+	"MM": "01", "M": "1",
+	"DD": "02", "D": "2",
+	"HH": "15", "mm": "04", "ss": "05",
+}
+
+// dateFormatLayout turns a pattern such as DD/MM/YYYY HH:mm into a time layout.
+// Each run of one letter is a token; the letter T may stand alone between
+// date and time. Other letters, and digits, which a layout would read as
+// tokens of its own, are rejected.
+func dateFormatLayout(format string) (string, error) {
+	var layout strings.Builder
+	for i := 0; i < len(format); {
+		c := format[i]
+		j := i + 1
+		for j < len(format) && format[j] == c {
+			j++
+		}
+		run := format[i:j]
+		switch {
+		case run == "T":
+			layout.WriteString(run)
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			token, ok := dateTokens[run]
+			if !ok {
+				return "", fmt.Errorf("date_format %q has unknown token %q; use YYYY, YY, MM, M, DD, D, HH, mm and ss", format, run)
+			}
+			layout.WriteString(token)
+		case c >= '0' && c <= '9':
+			return "", fmt.Errorf("date_format %q must not contain digits", format)
+		default:
+			layout.WriteString(run)
+		}
+		i = j
+	}
+	return layout.String(), nil
+}
+
+// parseImportOptions reads the query of POST /expenses/import:
+//
+//	columns=title:Description,amount:Debit,spent_at:Date
+//	header=false, delimiter=; or tab, date_format=DD/MM/YYYY,
+//	decimal=, tag_separator=; dry_run=true skip_invalid=true
+func parseImportOptions(c echo.Context) (ImportOptions, error) {
+	opts := ImportOptions{Header: true, Delimiter: ',', Decimal: ".", TagSeparator: ";"}
+	var err error
+	for _, p := range []struct {
+		name string
+		dest *bool
+	}{{"header", &opts.Header}, {"dry_run", &opts.DryRun}, {"skip_invalid", &opts.SkipInvalid}} {
+		if v := c.QueryParam(p.name); v != "" {
+			if *p.dest, err = strconv.ParseBool(v); err != nil {
+				return opts, fmt.Errorf("%s must be true or false", p.name)
+			}
+		}
+	}
+
+	switch v := c.QueryParam("delimiter"); v {
+	case "":
+	case "tab":
+		opts.Delimiter = '\t'
+	default:
+		r, size := utf8.DecodeRuneInString(v)
+		if size != len(v) || r == '"' || r == '\r' || r == '\n' {
+			return opts, fmt.Errorf("delimiter must be a single character or tab")
+		}
+		opts.Delimiter = r
+	}
+
+	switch v := c.QueryParam("decimal"); v {
+	case "":
+	case ".", ",":
+		opts.Decimal = v
+	default:
+		return opts, fmt.Errorf(`decimal must be "." or ","`)
+	}
+
+	if v := c.QueryParam("date_format"); v != "" {
+		if opts.DateLayout, err = dateFormatLayout(v); err != nil {
+			return opts, err
+		}
+	}
+	if v := c.QueryParam("tag_separator"); v != "" {
+		opts.TagSeparator = v
+	}
+
+	opts.Columns = map[string]string{}
+	if !opts.Header {
+		// Without a header the columns follow the order of the fields.
+		for i, field := range importFields {
+			opts.Columns[field] = strconv.Itoa(i + 1)
+		}
+	}
+	if v := c.QueryParam("columns"); v != "" {
+		if !opts.Header {
+			opts.Columns = map[string]string{}
+		}
+		for _, pair := range strings.Split(v, ",") {
+			field, column, ok := strings.Cut(pair, ":")
+			field = strings.ToLower(strings.TrimSpace(field))
+			if !ok || !containsString(importFields, field) {
+				return opts, fmt.Errorf("columns takes field:column pairs, with fields among %s", strings.Join(importFields, ", "))
+			}
+			opts.Columns[field] = strings.TrimSpace(column)
+		}
+	}
+	return opts, nil
+}
+
+// columnIndexes resolves the column of each mapped field. Unmapped fields
+// are read from the header column of the same name, if there is one.
+func (opts ImportOptions) columnIndexes(header []string) (map[string]int, error) {
+	byName := map[string]int{}
+	for i, name := range header {
+		byName[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	cols := map[string]int{}
+	for _, field := range importFields {
+		column, mapped := opts.Columns[field]
+		switch {
+		case !opts.Header && mapped:
+			n, err := strconv.Atoi(column)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("without a header, column of %s must be a position from 1", field)
+			}
+			cols[field] = n - 1
+		case mapped:
+			i, ok := byName[strings.ToLower(column)]
+			if !ok {
+				return nil, fmt.Errorf("csv header has no column %q for %s", column, field)
+			}
+			cols[field] = i
+		default:
+			if i, ok := byName[field]; ok && opts.Header {
+				cols[field] = i
+			}
+		}
+	}
+	for _, field := range []string{"title", "amount"} {
+		if _, ok := cols[field]; !ok {
+			return nil, fmt.Errorf("csv has no column for %s", field)
+		}
+	}
+	return cols, nil
+}
+
+// parseAmount reads an amount written with opts.Decimal as the decimal
+// separator. The other separator and spaces may group thousands, but only
+// between groups of three digits, so that 1,50 is not read as 150. What is
+// left must be a plain decimal for ParseMoney.
+func (opts ImportOptions) parseAmount(s string) (Money, error) {
+	grouping := ","
+	if opts.Decimal == "," {
+		grouping = "."
+	}
+	s = strings.TrimSpace(s)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	} else {
+		s = strings.TrimPrefix(s, "+")
+	}
+	whole, fraction, hasFraction := strings.Cut(s, opts.Decimal)
+
+	whole = strings.NewReplacer(" ", grouping, "\u00a0", grouping).Replace(whole)
+	if strings.Contains(whole, grouping) {
+		groups := strings.Split(whole, grouping)
+		for i, g := range groups {
+			if len(g) != 3 && (i > 0 || len(g) == 0 || len(g) > 3) {
+				return 0, fmt.Errorf("invalid amount %q", s)
+			}
+		}
+		whole = strings.Join(groups, "")
+	}
+
+	s = sign + whole
+	if hasFraction {
+		s += "." + fraction
+	}
+	return ParseMoney(s)
+}
+
+func (opts ImportOptions) parseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if opts.DateLayout != "" {
+		return time.Parse(opts.DateLayout, s)
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(dateLayout, s)
+}
+
+// parseExpensesCSV reads every record of r into a row, valid or not. Only a
+// file that can not be read as CSV at all is an error.
+func parseExpensesCSV(r io.Reader, opts ImportOptions) ([]ImportRow, error) {
+	cr := csv.NewReader(r)
+	cr.Comma = opts.Delimiter
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var header []string
+	if opts.Header {
+		var err error
+		if header, err = cr.Read(); err != nil {
+			return nil, fmt.Errorf("read csv header: %w", err)
+		}
+		if len(header) > 0 {
+			header[0] = strings.TrimPrefix(header[0], "\ufeff")
+		}
+	}
+	cols, err := opts.columnIndexes(header)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []ImportRow{}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Rows are reported by the line of the file they start on, which
+		// blank lines and quoted line breaks keep from being a count.
+		line, _ := cr.FieldPos(0)
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		if len(rows) == maxImportRows {
+			return nil, fmt.Errorf("csv has more than %d rows", maxImportRows)
+		}
+		rows = append(rows, opts.parseRow(line, record, cols))
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("csv contains no expenses")
+	}
+	return rows, nil
+}
+
+func (opts ImportOptions) parseRow(line int, record []string, cols map[string]int) ImportRow {
+	row := ImportRow{Line: line}
+	add := func(field, code, format string, args ...interface{}) {
+		row.Errors = append(row.Errors, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+	value := func(field string) (string, bool) {
+		i, ok := cols[field]
+		if !ok {
+			return "", false
+		}
+		if i >= len(record) {
+			add(field, CodeRequired, "line has no column %d", i+1)
+			return "", false
+		}
+		return record[i], true
+	}
+
+	var ex Expense
+	var badAmount bool
+	ex.Title, _ = value("title")
+	ex.Currency, _ = value("currency")
+	ex.Note, _ = value("note")
+	if v, ok := value("amount"); ok && strings.TrimSpace(v) == "" {
+		add("amount", CodeRequired, "amount is required")
+		badAmount = true
+	} else if ok {
+		amount, err := opts.parseAmount(v)
+		if err != nil {
+			add("amount", CodeInvalid, "amount %q is not a number", v)
+			badAmount = true
+		}
+		ex.Amount = amount
+	}
+	if v, ok := value("tags"); ok && strings.TrimSpace(v) != "" {
+		ex.Tags = strings.Split(v, opts.TagSeparator)
+	}
+	if v, ok := value("spent_at"); ok && strings.TrimSpace(v) != "" {
+		spentAt, err := opts.parseDate(v)
+		if err != nil {
+			add("spent_at", CodeInvalid, "spent_at %q does not match the date format", v)
+		} else {
+			ex.SpentAt = &spentAt
+		}
+	}
+
+	normalizeExpense(&ex)
+	if ex.Tags == nil {
+		ex.Tags = []string{}
+	}
+	// A malformed amount is reported once, not again as a non-positive one.
+	for _, e := range validateExpense(ex) {
+		if e.Field != "amount" || !badAmount {
+			row.Errors = append(row.Errors, e)
+		}
+	}
+
+	row.Expense = &ex
+	row.Status = ImportValid
+	if len(row.Errors) > 0 {
+		row.Status = ImportInvalid
+	}
+	return row
+}
+
+// csvUpload opens the CSV sent as the multipart field "file", or else the
+// raw request body. Only multipart requests are read as forms: parsing a
+// body sent as application/x-www-form-urlencoded would consume it.
+func csvUpload(c echo.Context) (io.ReadCloser, error) {
+	req := c.Request()
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get(echo.HeaderContentType))
+	if mediaType != echo.MIMEMultipartForm {
+		return req.Body, nil
+	}
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	return fh.Open()
+}
+
+// ImportExpensesHandler creates expenses from a CSV file, sent as the
+// multipart field "file" or as the raw request body, read as described by
+// parseImportOptions. Every line is reported on. With dry_run nothing is
+// stored; otherwise the valid rows are stored together or not at all, and
+// any invalid row stops the import unless skip_invalid is set.
+func (h *handler) ImportExpensesHandler(c echo.Context) error {
+	owner, err := ownerID(c)
+	if err != nil {
+		return err
+	}
+	opts, err := parseImportOptions(c)
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+
+	body, err := csvUpload(c)
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+	defer body.Close()
+
+	rows, err := parseExpensesCSV(body, opts)
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+
+	report := ImportReport{DryRun: opts.DryRun, Total: len(rows), Rows: rows}
+	now := time.Now()
+	var valid []Expense
+	for _, row := range rows {
+		if row.Status == ImportValid {
+			if row.Expense.SpentAt == nil {
+				row.Expense.SpentAt = &now
+			}
+			valid = append(valid, *row.Expense)
+		}
+	}
+	report.Valid = len(valid)
+	report.Invalid = report.Total - report.Valid
+
+	switch {
+	case opts.DryRun:
+		return c.JSON(http.StatusOK, report)
+	case report.Invalid > 0 && !opts.SkipInvalid:
+		return c.JSON(http.StatusUnprocessableEntity, report)
+	case len(valid) == 0:
+		return c.JSON(http.StatusOK, report)
+	}
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	created, err := h.Store.Import(ctx, owner, valid)
+	if err != nil {
+		return storeError(c, err)
+	}
+	for i, row := range rows {
+		if row.Status == ImportValid {
+			ex := created[0]
+			created = created[1:]
+			countCreated(ex)
+			rows[i].Status, rows[i].Expense = ImportImported, &ex
+			report.Imported++
+		}
+	}
+	return c.JSON(http.StatusCreated, report)
+}
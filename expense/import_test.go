@@ -0,0 +1,210 @@
+//go:build unit
+// +build unit
+
+package expense
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func importCSV(t *testing.T, h *handler, query, body string) (int, ImportReport) {
+	req := httptest.NewRequest(http.MethodPost, "/expenses/import?"+query, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, "text/csv")
+	rec := httptest.NewRecorder()
+	c := withOwner(echo.New().NewContext(req, rec))
+	if err := h.ImportExpensesHandler(c); err != nil {
+		t.Fatal(err)
+	}
+	var report ImportReport
+	if rec.Code != http.StatusBadRequest {
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	}
+	return rec.Code, report
+}
+
+func rowErrors(report ImportReport) map[int][]string {
+	errs := map[int][]string{}
+	for _, row := range report.Rows {
+		for _, e := range row.Errors {
+			errs[row.Line] = append(errs[row.Line], e.Field+":"+e.Code)
+		}
+	}
+	return errs
+}
+
+func TestImportExpenses(t *testing.T) {
+	bank := "Date;Description;Debit;Category\n" +
+		"31/01/2023;Rent;12.000,00;home\n" +
+		"01/02/2023;Noodles;1.234,5;food;lunch\n" +
+		"30/02/2023;Mystery;abc;\n" +
+		";;;\n"
+	bankQuery := "delimiter=%3B&decimal=,&date_format=DD/MM/YYYY&columns=title:Description,amount:Debit,spent_at:Date,tags:Category"
+
+	t.Run("dry runs report on every row and store nothing", func(t *testing.T) {
+		store := NewMemoryStore()
+		code, report := importCSV(t, NewHandler(store), bankQuery+"&dry_run=true", bank)
+
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, ImportReport{DryRun: true, Total: 4, Valid: 2, Invalid: 2}, ImportReport{
+			DryRun: report.DryRun, Total: report.Total, Valid: report.Valid, Invalid: report.Invalid, Imported: report.Imported,
+		})
+		assert.Equal(t, map[int][]string{
+			4: {"amount:invalid", "spent_at:invalid"},
+			5: {"amount:required", "title:required"},
+		}, rowErrors(report))
+		if assert.Len(t, report.Rows, 4) {
+			ex := report.Rows[1].Expense
+			assert.Equal(t, Money(123450), ex.Amount)
+			assert.Equal(t, []string{"food"}, ex.Tags)
+			assert.Equal(t, "2023-02-01", ex.SpentAt.Format(dateLayout))
+		}
+
+		expenses, _ := store.List(context.Background(), ListQuery{OwnerID: "alice", Limit: 10})
+		assert.Empty(t, expenses)
+	})
+
+	t.Run("invalid rows stop the import", func(t *testing.T) {
+		store := NewMemoryStore()
+		code, report := importCSV(t, NewHandler(store), bankQuery, bank)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, code)
+		assert.Equal(t, 0, report.Imported)
+		expenses, _ := store.List(context.Background(), ListQuery{OwnerID: "alice", Limit: 10})
+		assert.Empty(t, expenses)
+	})
+
+	t.Run("skip_invalid imports the valid rows", func(t *testing.T) {
+		store := NewMemoryStore()
+		code, report := importCSV(t, NewHandler(store), bankQuery+"&skip_invalid=true", bank)
+
+		assert.Equal(t, http.StatusCreated, code)
+		assert.Equal(t, 2, report.Imported)
+		var statuses []string
+		for _, row := range report.Rows {
+			statuses = append(statuses, row.Status)
+		}
+		assert.Equal(t, []string{ImportImported, ImportImported, ImportInvalid, ImportInvalid}, statuses)
+		assert.NotZero(t, report.Rows[0].Expense.ID)
+
+		expenses, _ := store.List(context.Background(), ListQuery{OwnerID: "alice", Limit: 10})
+		assert.Len(t, expenses, 2)
+	})
+
+	t.Run("files without a header are read by position", func(t *testing.T) {
+		code, report := importCSV(t, NewHandler(NewMemoryStore()), "header=false&columns=spent_at:1,title:2,amount:3&tag_separator=|",
+			"2023-01-05T10:00:00Z,coffee,\"1,060.50\"\n2023-01-06,tea,45\n")
+
+		assert.Equal(t, http.StatusCreated, code)
+		assert.Equal(t, 2, report.Imported)
+		assert.Equal(t, Money(106050), report.Rows[0].Expense.Amount)
+	})
+
+	t.Run("amounts that are not plain numbers are invalid rows", func(t *testing.T) {
+		_, report := importCSV(t, NewHandler(NewMemoryStore()), "dry_run=true", "title,amount\nrent,1_000\nfee,0x10\ntip,1e2\ncoffee,60\n")
+
+		assert.Equal(t, map[int][]string{
+			2: {"amount:invalid"},
+			3: {"amount:invalid"},
+			4: {"amount:invalid"},
+		}, rowErrors(report))
+		assert.Equal(t, 1, report.Valid)
+	})
+
+	t.Run("rows are reported by the line they start on", func(t *testing.T) {
+		_, report := importCSV(t, NewHandler(NewMemoryStore()), "dry_run=true", "title,amount\n\ncoffee,60\n\"multi\nline\",5\nbad,\n")
+
+		lines := []int{}
+		for _, row := range report.Rows {
+			lines = append(lines, row.Line)
+		}
+		assert.Equal(t, []int{3, 4, 6}, lines)
+		assert.Equal(t, map[int][]string{6: {"amount:required"}}, rowErrors(report))
+	})
+
+	t.Run("files are read from uploads and any raw body", func(t *testing.T) {
+		var form bytes.Buffer
+		mw := multipart.NewWriter(&form)
+		f, _ := mw.CreateFormFile("file", "expenses.csv")
+		io.WriteString(f, "title,amount\ncoffee,60\n")
+		mw.Close()
+
+		for contentType, body := range map[string]string{
+			mw.FormDataContentType():                     form.String(),
+			echo.MIMEApplicationForm:                     "title,amount\ncoffee,60\n",
+			echo.MIMEApplicationForm + "; charset=utf-8": "title,amount\ncoffee,60\n",
+			echo.MIMETextPlainCharsetUTF8:                "title,amount\ncoffee,60\n",
+		} {
+			req := httptest.NewRequest(http.MethodPost, "/expenses/import", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, contentType)
+			rec := httptest.NewRecorder()
+			assert.NoError(t, NewHandler(NewMemoryStore()).ImportExpensesHandler(withOwner(echo.New().NewContext(req, rec))))
+			assert.Equal(t, http.StatusCreated, rec.Code, contentType)
+		}
+	})
+
+	t.Run("unreadable files and options are rejected", func(t *testing.T) {
+		for query, body := range map[string]string{
+			"":                           "name,amount\ncoffee,60\n",
+			"columns=title:Name":         "title,amount\ncoffee,60\n",
+			"columns=price:amount":       "title,amount\ncoffee,60\n",
+			"header=false&columns=title": "coffee,60\n",
+			"decimal=%3B":                "title,amount\ncoffee,60\n",
+			"dry_run=maybe":              "title,amount\ncoffee,60\n",
+			"delimiter=ab":               "title,amount\ncoffee,60\n",
+			"date_format=D%20MMM%20YYYY": "title,amount\ncoffee,60\n",
+		} {
+			code, _ := importCSV(t, NewHandler(NewMemoryStore()), query, body)
+			assert.Equal(t, http.StatusBadRequest, code, query)
+		}
+		code, _ := importCSV(t, NewHandler(NewMemoryStore()), "", "title,amount\n")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
+
+func TestImportParseAmount(t *testing.T) {
+	for decimal, cases := range map[string]map[string]string{
+		".": {"1,060.50": "1060.5", "1 234 567": "1234567", "12": "12", "0.5": "0.5", "+7": "7", "1,50": "", "1,0000": "", ",100": "", "1,,000": "", "1.000.5": "", "1_000": "", "0x10": "", "1e2": ""},
+		",": {"12.000,00": "12000", "1.234,5": "1234.5", "1,50": "1.5", "1.5": "", "12.00": ""},
+	} {
+		opts := ImportOptions{Decimal: decimal}
+		for in, want := range cases {
+			got, err := opts.parseAmount(in)
+			if want == "" {
+				assert.Error(t, err, "%s with decimal %s", in, decimal)
+				continue
+			}
+			if assert.NoError(t, err, in) {
+				assert.Equal(t, want, got.String(), in)
+			}
+		}
+	}
+}
+
+func TestImportDateFormat(t *testing.T) {
+	for format, want := range map[string]string{
+		"DD/MM/YYYY HH:mm":    "02/01/2006 15:04",
+		"D.M.YY":              "2.1.06",
+		"YYYY-MM-DDTHH:mm:ss": "2006-01-02T15:04:05",
+	} {
+		layout, err := dateFormatLayout(format)
+		if assert.NoError(t, err, format) {
+			assert.Equal(t, want, layout, format)
+		}
+	}
+	for _, format := range []string{"D MMM YYYY", "DD/MM/YYYY Mon", "YYYY-MM-DD hh:mm", "DD/MM/2006"} {
+		_, err := dateFormatLayout(format)
+		if assert.Error(t, err, format) {
+			assert.Contains(t, err.Error(), format)
+		}
+	}
+}
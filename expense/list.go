@@ -0,0 +1,467 @@
+package expense
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TagMatchAny = "any"
+	TagMatchAll = "all"
+)
+
+// ListQuery describes the filters, ordering and page of an expense listing.
+// SpentTo and CreatedTo are exclusive; a date without a time selects the
+// whole day.
+type ListQuery struct {
+	OwnerID     string
+	Tags        []string
+	TagMatch    string
+	MinAmount   *Money
+	MaxAmount   *Money
+	Title       string
+	Note        string
+	SpentFrom   *time.Time
+	SpentTo     *time.Time
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	IDs         []int
+	Sort        []SortField
+	Limit       int
+	After       *cursor
+}
+
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+type sortColumn struct {
+	column string
+	value  func(ex Expense) interface{}
+	parse  func(v interface{}) (interface{}, bool)
+}
+
+var sortColumns = map[string]sortColumn{
+	"id": {
+		column: "id",
+		value:  func(ex Expense) interface{} { return ex.ID },
+		parse:  parseCursorInt,
+	},
+	"title": {
+		column: "title",
+		value:  func(ex Expense) interface{} { return ex.Title },
+		parse:  parseCursorString,
+	},
+	"amount": {
+		column: "amount",
+		value:  func(ex Expense) interface{} { return ex.Amount.String() },
+		parse:  parseCursorMoney,
+	},
+	"note": {
+		column: "note",
+		value:  func(ex Expense) interface{} { return ex.Note },
+		parse:  parseCursorString,
+	},
+	"spent_at": {
+		column: "spent_at",
+		value:  func(ex Expense) interface{} { return ex.SpentAt },
+		parse:  parseCursorTime,
+	},
+	"created_at": {
+		column: "created_at",
+		value:  func(ex Expense) interface{} { return ex.CreatedAt },
+		parse:  parseCursorTime,
+	},
+	"updated_at": {
+		column: "updated_at",
+		value:  func(ex Expense) interface{} { return ex.UpdatedAt },
+		parse:  parseCursorTime,
+	},
+}
+
+func parseCursorInt(v interface{}) (interface{}, bool) {
+	f, ok := v.(float64)
+	return int(f), ok && f == float64(int(f))
+}
+
+func parseCursorMoney(v interface{}) (interface{}, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, false
+	}
+	m, err := ParseMoney(s)
+	return m, err == nil
+}
+
+func parseCursorString(v interface{}) (interface{}, bool) {
+	s, ok := v.(string)
+	return s, ok
+}
+
+func parseCursorTime(v interface{}) (interface{}, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	return t, err == nil
+}
+
+func parseListQuery(c echo.Context, maxSize int) (ListQuery, bool, error) {
+	q, err := parseListFilter(c)
+	if err != nil {
+		return q, false, err
+	}
+
+	if q.Sort, err = parseSort(c.QueryParam("sort")); err != nil {
+		return q, false, err
+	}
+
+	page, err := parsePageRequest(c, maxSize)
+	if err != nil {
+		return q, false, err
+	}
+	q.Limit = page.Limit
+	if page.After != nil {
+		if page.After.Sort != sortKey(q.Sort) {
+			return q, false, errInvalidCursor
+		}
+		q.After = page.After
+	}
+
+	return q, page.Paging, nil
+}
+
+// parseListFilter reads the filters of a listing, leaving out its order and
+// page.
+func parseListFilter(c echo.Context) (ListQuery, error) {
+	q := ListQuery{TagMatch: TagMatchAny}
+
+	for _, v := range c.QueryParams()["tag"] {
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				q.Tags = append(q.Tags, tag)
+			}
+		}
+	}
+	switch m := c.QueryParam("tag_match"); m {
+	case "", TagMatchAny:
+	case TagMatchAll:
+		q.TagMatch = TagMatchAll
+	default:
+		return q, fmt.Errorf("tag_match must be %q or %q", TagMatchAny, TagMatchAll)
+	}
+
+	var err error
+	if q.MinAmount, err = parseMoneyParam(c, "min_amount"); err != nil {
+		return q, err
+	}
+	if q.MaxAmount, err = parseMoneyParam(c, "max_amount"); err != nil {
+		return q, err
+	}
+	if q.MinAmount != nil && q.MaxAmount != nil && *q.MinAmount > *q.MaxAmount {
+		return q, fmt.Errorf("min_amount must not be greater than max_amount")
+	}
+
+	q.Title = c.QueryParam("title")
+	q.Note = c.QueryParam("note")
+
+	if q.SpentFrom, err = parseTimeParam(c, "spent_from", false); err != nil {
+		return q, err
+	}
+	if q.SpentTo, err = parseTimeParam(c, "spent_to", true); err != nil {
+		return q, err
+	}
+	if q.CreatedFrom, err = parseTimeParam(c, "created_from", false); err != nil {
+		return q, err
+	}
+	if q.CreatedTo, err = parseTimeParam(c, "created_to", true); err != nil {
+		return q, err
+	}
+
+	if v := c.QueryParam("ids"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				return q, fmt.Errorf("ids must be a comma separated list of integers")
+			}
+			q.IDs = append(q.IDs, id)
+		}
+	}
+
+	return q, nil
+}
+
+func parseMoneyParam(c echo.Context, name string) (*Money, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return nil, nil
+	}
+	m, err := ParseMoney(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return &m, nil
+}
+
+func parseTimeParam(c echo.Context, name string, endOfDay bool) (*time.Time, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a date (2006-01-02) or RFC 3339 timestamp", name)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// parseSort reads "field,-field" and always ends with id so that the order,
+// and therefore the keyset cursor, is total.
+func parseSort(v string) ([]SortField, error) {
+	var fields []SortField
+	seen := map[string]bool{}
+	for _, s := range strings.Split(v, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		f := SortField{Field: s}
+		if strings.HasPrefix(s, "-") {
+			f = SortField{Field: s[1:], Desc: true}
+		} else if strings.HasPrefix(s, "+") {
+			f.Field = s[1:]
+		}
+		if _, ok := sortColumns[f.Field]; !ok {
+			return nil, fmt.Errorf("can not sort by %q", f.Field)
+		}
+		if seen[f.Field] {
+			return nil, fmt.Errorf("duplicate sort field %q", f.Field)
+		}
+		seen[f.Field] = true
+		fields = append(fields, f)
+	}
+	if !seen["id"] {
+		fields = append(fields, SortField{Field: "id"})
+	}
+	return fields, nil
+}
+
+func sortKey(fields []SortField) string {
+	keys := make([]string, len(fields))
+	for i, f := range fields {
+		keys[i] = f.Field
+		if f.Desc {
+			keys[i] = "-" + f.Field
+		}
+	}
+	return strings.Join(keys, ",")
+}
+
+func (q ListQuery) cursorFor(ex Expense) cursor {
+	cur := cursor{Sort: sortKey(q.Sort)}
+	for _, f := range q.Sort {
+		cur.Values = append(cur.Values, sortColumns[f.Field].value(ex))
+	}
+	return cur
+}
+
+// sqlDialect renders the parts of a listing or report query that differ
+// between databases.
+type sqlDialect interface {
+	placeholder(n int) string
+	// bind converts a Go value to what the driver stores for it.
+	bind(v interface{}) interface{}
+	// scan wraps a *Money, *[]string or **time.Time scan destination so
+	// that it reads what bind stored.
+	scan(dest interface{}) interface{}
+	// forUpdate is appended to a SELECT to lock its rows until the end of
+	// the transaction.
+	forUpdate() string
+	hasTags(args *sqlArgs, tags []string, all bool) string
+	contains(column, pattern string) string
+	idIn(args *sqlArgs, ids []int) string
+	// unnestTags joins one row per tag of the tags column, or a single NULL
+	// tag if there are none, and returns the join and the tag column.
+	unnestTags(tags string) (join, column string)
+	tagIn(args *sqlArgs, column string, tags []string) string
+	// period truncates a timestamp column to the UTC start of its day,
+	// week, month or year, formatted as 2006-01-02.
+	period(unit, column string) string
+}
+
+type sqlArgs struct {
+	dialect sqlDialect
+	values  []interface{}
+}
+
+func (a *sqlArgs) add(v interface{}) string {
+	a.values = append(a.values, a.dialect.bind(v))
+	return a.dialect.placeholder(len(a.values))
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) placeholder(n int) string { return "$" + strconv.Itoa(n) }
+
+func (postgresDialect) bind(v interface{}) interface{} {
+	if tags, ok := v.([]string); ok {
+		return pq.Array(tags)
+	}
+	return v
+}
+
+func (postgresDialect) scan(dest interface{}) interface{} {
+	if tags, ok := dest.(*[]string); ok {
+		return pq.Array(tags)
+	}
+	return dest
+}
+
+func (postgresDialect) forUpdate() string { return " FOR UPDATE" }
+
+func (postgresDialect) hasTags(args *sqlArgs, tags []string, all bool) string {
+	op := "&&"
+	if all {
+		op = "@>"
+	}
+	return "tags " + op + " " + args.add(pq.Array(tags))
+}
+
+func (postgresDialect) contains(column, pattern string) string {
+	return column + " ILIKE '%' || " + pattern + " || '%'"
+}
+
+func (postgresDialect) idIn(args *sqlArgs, ids []int) string {
+	values := make([]int64, len(ids))
+	for i, id := range ids {
+		values[i] = int64(id)
+	}
+	return "id = ANY(" + args.add(pq.Array(values)) + ")"
+}
+
+func (postgresDialect) unnestTags(tags string) (string, string) {
+	return "LEFT JOIN LATERAL unnest(" + tags + ") AS t(tag) ON true", "t.tag"
+}
+
+func (postgresDialect) tagIn(args *sqlArgs, column string, tags []string) string {
+	return column + " = ANY(" + args.add(pq.Array(tags)) + ")"
+}
+
+func (postgresDialect) period(unit, column string) string {
+	return "to_char(date_trunc('" + unit + "', " + column + " AT TIME ZONE 'UTC'), 'YYYY-MM-DD')"
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// where renders the filters of q as a SQL condition. Every user supplied
+// value is passed as a bind parameter.
+func (q ListQuery) where(args *sqlArgs) (string, error) {
+	conds := []string{"owner_id = " + args.add(q.OwnerID), "deleted_at IS NULL"}
+
+	if len(q.Tags) > 0 {
+		conds = append(conds, args.dialect.hasTags(args, q.Tags, q.TagMatch == TagMatchAll))
+	}
+	if q.MinAmount != nil {
+		conds = append(conds, "amount >= "+args.add(*q.MinAmount))
+	}
+	if q.MaxAmount != nil {
+		conds = append(conds, "amount <= "+args.add(*q.MaxAmount))
+	}
+	if q.Title != "" {
+		conds = append(conds, args.dialect.contains("title", args.add(escapeLike(q.Title))))
+	}
+	if q.Note != "" {
+		conds = append(conds, args.dialect.contains("note", args.add(escapeLike(q.Note))))
+	}
+	if q.SpentFrom != nil {
+		conds = append(conds, "spent_at >= "+args.add(*q.SpentFrom))
+	}
+	if q.SpentTo != nil {
+		conds = append(conds, "spent_at < "+args.add(*q.SpentTo))
+	}
+	if q.CreatedFrom != nil {
+		conds = append(conds, "created_at >= "+args.add(*q.CreatedFrom))
+	}
+	if q.CreatedTo != nil {
+		conds = append(conds, "created_at < "+args.add(*q.CreatedTo))
+	}
+	if len(q.IDs) > 0 {
+		conds = append(conds, args.dialect.idIn(args, q.IDs))
+	}
+
+	if q.After != nil {
+		keyset, err := q.keyset(args)
+		if err != nil {
+			return "", err
+		}
+		conds = append(conds, keyset)
+	}
+
+	return strings.Join(conds, " AND "), nil
+}
+
+// afterValues decodes the cursor values of q.After, one per sort field.
+func (q ListQuery) afterValues() ([]interface{}, error) {
+	if len(q.After.Values) != len(q.Sort) {
+		return nil, errInvalidCursor
+	}
+
+	values := make([]interface{}, len(q.Sort))
+	for i, f := range q.Sort {
+		v, ok := sortColumns[f.Field].parse(q.After.Values[i])
+		if !ok {
+			return nil, errInvalidCursor
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// keyset expands the cursor into (a > x) OR (a = x AND b < y) ... following
+// the direction of each sort field.
+func (q ListQuery) keyset(args *sqlArgs) (string, error) {
+	values, err := q.afterValues()
+	if err != nil {
+		return "", err
+	}
+
+	var ors []string
+	for i, f := range q.Sort {
+		var ands []string
+		for j := 0; j < i; j++ {
+			ands = append(ands, sortColumns[q.Sort[j].Field].column+" = "+args.add(values[j]))
+		}
+		op := ">"
+		if f.Desc {
+			op = "<"
+		}
+		ands = append(ands, sortColumns[f.Field].column+" "+op+" "+args.add(values[i]))
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", nil
+}
+
+func (q ListQuery) orderBy() string {
+	order := make([]string, len(q.Sort))
+	for i, f := range q.Sort {
+		order[i] = sortColumns[f.Field].column + " ASC"
+		if f.Desc {
+			order[i] = sortColumns[f.Field].column + " DESC"
+		}
+	}
+	return strings.Join(order, ", ")
+}
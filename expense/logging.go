@@ -0,0 +1,154 @@
+package expense
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	requestIDKey = "request_id"
+	loggerKey    = "logger"
+
+	internalErrorMessage = "internal server error"
+	maxRequestIDLength   = 128
+)
+
+// RequestID gives every request an id, kept in the X-Request-ID response
+// header. An incoming X-Request-ID is reused so that one id can follow a
+// call across services, unless it could garble the logs.
+func RequestID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id := c.Request().Header.Get(echo.HeaderXRequestID)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			c.Set(requestIDKey, id)
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+			return next(c)
+		}
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func requestID(c echo.Context) string {
+	id, _ := c.Get(requestIDKey).(string)
+	return id
+}
+
+// logger returns the logger of the request, which tags every line with the
+// request id.
+func logger(c echo.Context) *slog.Logger {
+	if l, ok := c.Get(loggerKey).(*slog.Logger); ok {
+		return l
+	}
+	if id := requestID(c); id != "" {
+		return slog.Default().With(requestIDKey, id)
+	}
+	return slog.Default()
+}
+
+// Logging writes one line per request to l and hands the handlers a logger
+// tagged with the request id. Errors are rendered here, so the line has the
+// final status.
+func Logging(l *slog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			rl := l
+			if id := requestID(c); id != "" {
+				rl = l.With(requestIDKey, id)
+			}
+			c.Set(loggerKey, rl)
+
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			req, res := c.Request(), c.Response()
+			attrs := []slog.Attr{
+				slog.String("method", req.Method),
+				slog.String("route", c.Path()),
+				slog.String("uri", req.RequestURI),
+				slog.Int("status", res.Status),
+				slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.Int64("bytes_out", res.Size),
+				slog.String("remote_ip", c.RealIP()),
+			}
+			if p, ok := PrincipalFrom(c); ok {
+				attrs = append(attrs, slog.String("subject", p.Subject))
+			}
+			if sc := trace.SpanContextFromContext(req.Context()); sc.IsValid() {
+				attrs = append(attrs, slog.String("trace_id", sc.TraceID().String()))
+			}
+			rl.LogAttrs(req.Context(), slog.LevelInfo, "request", attrs...)
+			return nil
+		}
+	}
+}
+
+// LogPanic logs a panic recovered by echo's Recover middleware with its
+// stack, which the error handed on to ErrorHandler does not carry.
+func LogPanic(c echo.Context, err error, stack []byte) error {
+	logger(c).Error("panic recovered", "error", err, "stack", string(stack))
+	return err
+}
+
+// ErrorHandler renders errors returned by handlers and middleware as Err
+// with the request id. Errors other than echo.HTTPError are unexpected, so
+// they are logged and replaced by a generic message.
+func ErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	code, message := http.StatusInternalServerError, internalErrorMessage
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		code, message = he.Code, fmt.Sprint(he.Message)
+		if he.Internal != nil {
+			err = he.Internal
+		}
+	}
+	if code >= http.StatusInternalServerError {
+		logger(c).Error("request failed", "error", err)
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(code)
+	} else {
+		err = errorJSON(c, code, Err{Message: message})
+	}
+	if err != nil {
+		logger(c).Error("can't write error response", "error", err)
+	}
+}
@@ -0,0 +1,115 @@
+//go:build unit
+// +build unit
+
+package expense
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/exp/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// withLogs gives c a logger writing JSON lines to the returned buffer.
+func withLogs(c echo.Context) (echo.Context, *bytes.Buffer) {
+	var logs bytes.Buffer
+	c.Set(loggerKey, slog.New(slog.NewJSONHandler(&logs)))
+	return c, &logs
+}
+
+func logLines(t *testing.T, logs *bytes.Buffer) []map[string]interface{} {
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+		lines = append(lines, m)
+	}
+	return lines
+}
+
+func TestLogging(t *testing.T) {
+	newServer := func(logs *bytes.Buffer) *echo.Echo {
+		e := echo.New()
+		e.HTTPErrorHandler = ErrorHandler
+		e.Use(RequestID(), Logging(slog.New(slog.NewJSONHandler(logs))))
+		e.GET("/ok", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+		e.GET("/store", func(c echo.Context) error { return storeError(c, errors.New(`pq: relation "expenses" does not exist`)) })
+		e.GET("/fail", func(c echo.Context) error { return errors.New("pq: password authentication failed") })
+		e.GET("/denied", func(c echo.Context) error { return echo.ErrUnauthorized })
+		return e
+	}
+
+	t.Run("request ids are generated and echoed", func(t *testing.T) {
+		var logs bytes.Buffer
+		rec := httptest.NewRecorder()
+
+		newServer(&logs).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ok", nil))
+
+		id := rec.Header().Get(echo.HeaderXRequestID)
+		assert.Len(t, id, 32)
+		lines := logLines(t, &logs)
+		if assert.Len(t, lines, 1) {
+			assert.Equal(t, "request", lines[0]["msg"])
+			assert.Equal(t, id, lines[0]["request_id"])
+			assert.Equal(t, "/ok", lines[0]["route"])
+			assert.Equal(t, float64(http.StatusNoContent), lines[0]["status"])
+		}
+	})
+
+	t.Run("incoming request ids are reused unless unsafe", func(t *testing.T) {
+		for id, reused := range map[string]bool{
+			"upstream-42":      true,
+			"bad id\ninjected": false,
+			strings.Repeat("a", maxRequestIDLength+1): false,
+		} {
+			var logs bytes.Buffer
+			req := httptest.NewRequest(http.MethodGet, "/ok", nil)
+			req.Header.Set(echo.HeaderXRequestID, id)
+			rec := httptest.NewRecorder()
+
+			newServer(&logs).ServeHTTP(rec, req)
+
+			assert.Equal(t, reused, rec.Header().Get(echo.HeaderXRequestID) == id, id)
+		}
+	})
+
+	t.Run("internal errors are logged but not returned", func(t *testing.T) {
+		for _, path := range []string{"/store", "/fail"} {
+			var logs bytes.Buffer
+			rec := httptest.NewRecorder()
+
+			newServer(&logs).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+			id := rec.Header().Get(echo.HeaderXRequestID)
+			assert.Equal(t, http.StatusInternalServerError, rec.Code, path)
+			assert.Equal(t, `{"message":"internal server error","request_id":"`+id+`"}`, strings.TrimSpace(rec.Body.String()), path)
+			lines := logLines(t, &logs)
+			if assert.Len(t, lines, 2, path) {
+				assert.Equal(t, "ERROR", lines[0]["level"])
+				assert.Contains(t, lines[0]["error"], "pq: ")
+				assert.Equal(t, id, lines[0]["request_id"])
+				assert.Equal(t, float64(http.StatusInternalServerError), lines[1]["status"])
+			}
+		}
+	})
+
+	t.Run("http errors keep their message and gain the request id", func(t *testing.T) {
+		var logs bytes.Buffer
+		rec := httptest.NewRecorder()
+
+		newServer(&logs).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/denied", nil))
+
+		id := rec.Header().Get(echo.HeaderXRequestID)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, `{"message":"Unauthorized","request_id":"`+id+`"}`, strings.TrimSpace(rec.Body.String()))
+		assert.Len(t, logLines(t, &logs), 1)
+	})
+}
@@ -0,0 +1,114 @@
+package expense
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "code"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	expensesCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "expenses_created_total",
+		Help: "Expenses created, counted once per tag; untagged expenses count under an empty tag.",
+	}, []string{"tag"})
+)
+
+func init() {
+	prometheus.MustRegister(httpRequests, httpDuration, expensesCreated)
+}
+
+// maxTagLabels bounds the series of expenses_created_total, since tags are
+// free text. Tags seen after the limit count as otherTag.
+const (
+	maxTagLabels = 100
+	otherTag     = "_other"
+)
+
+var tagLabels = struct {
+	sync.Mutex
+	seen map[string]bool
+}{seen: map[string]bool{}}
+
+func tagLabel(tag string) string {
+	tag = strings.ToLower(tag)
+	tagLabels.Lock()
+	defer tagLabels.Unlock()
+	if !tagLabels.seen[tag] {
+		if len(tagLabels.seen) >= maxTagLabels {
+			return otherTag
+		}
+		tagLabels.seen[tag] = true
+	}
+	return tag
+}
+
+func countCreated(ex Expense) {
+	if len(ex.Tags) == 0 {
+		expensesCreated.WithLabelValues("").Inc()
+	}
+	for _, tag := range ex.Tags {
+		expensesCreated.WithLabelValues(tagLabel(tag)).Inc()
+	}
+}
+
+// Metrics records the count and latency of every request under its route
+// pattern, so that ids in paths do not create new series.
+func Metrics() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			code := c.Response().Status
+			if err != nil {
+				code = http.StatusInternalServerError
+				var he *echo.HTTPError
+				if errors.As(err, &he) {
+					code = he.Code
+				}
+			}
+
+			httpRequests.WithLabelValues(c.Request().Method, route, strconv.Itoa(code)).Inc()
+			httpDuration.WithLabelValues(c.Request().Method, route).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+// RegisterDBMetrics exports the connection pool stats of the SQL database
+// behind the store, if it has one.
+func (h *handler) RegisterDBMetrics() error {
+	db := sqlDB(h.Store)
+	if db == nil {
+		return nil
+	}
+	return prometheus.Register(collectors.NewDBStatsCollector(db, "expenses"))
+}
+
+// MetricsHandler serves every registered metric, including the Go runtime
+// and process ones, in the Prometheus text format.
+func MetricsHandler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.Handler())
+}
@@ -0,0 +1,62 @@
+//go:build unit
+// +build unit
+
+package expense
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Run("requests are counted by route pattern and status", func(t *testing.T) {
+		e := echo.New()
+		e.Use(Metrics())
+		e.GET("/expenses/:id", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+		e.GET("/denied", func(c echo.Context) error { return echo.ErrUnauthorized })
+
+		ok := testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/expenses/:id", "204"))
+		denied := testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/denied", "401"))
+		for _, path := range []string{"/expenses/1", "/expenses/2", "/denied"} {
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		}
+
+		assert.Equal(t, ok+2, testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/expenses/:id", "204")))
+		assert.Equal(t, denied+1, testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/denied", "401")))
+	})
+
+	t.Run("recovered panics are counted as errors", func(t *testing.T) {
+		e := echo.New()
+		e.Use(Metrics())
+		e.Use(middleware.RecoverWithConfig(middleware.RecoverConfig{LogErrorFunc: LogPanic}))
+		e.GET("/panic", func(c echo.Context) error { panic("boom") })
+
+		before := testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/panic", "500"))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Equal(t, before+1, testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/panic", "500")))
+	})
+
+	t.Run("created expenses are counted per tag", func(t *testing.T) {
+		before := testutil.ToFloat64(expensesCreated.WithLabelValues("metrics-food"))
+
+		countCreated(Expense{Tags: []string{"Metrics-Food", "metrics-drink"}})
+
+		assert.Equal(t, before+1, testutil.ToFloat64(expensesCreated.WithLabelValues("metrics-food")))
+	})
+
+	t.Run("tag labels are bounded", func(t *testing.T) {
+		for i := 0; i < maxTagLabels; i++ {
+			tagLabel("bounded-" + strconv.Itoa(i))
+		}
+		assert.Equal(t, otherTag, tagLabel("one-too-many"))
+	})
+}
@@ -2,14 +2,8 @@ package expense
 
 import "github.com/labstack/echo/v4"
 
+// CheckUserAuth only accepts the legacy shared Authorization header. Servers
+// should use Authenticate with the configured authenticators instead.
 func CheckUserAuth() echo.MiddlewareFunc {
-	return func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-			auth := c.Request().Header.Values("Authorization")
-			if auth != nil && auth[0] == "November 10, 2009" {
-				return next(c)
-			}
-			return echo.ErrUnauthorized
-		}
-	}
+	return Authenticate(LegacyAuthenticator{})
 }
@@ -0,0 +1,172 @@
+package expense
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// MoneyScale is the number of decimal places an amount may carry.
+const MoneyScale = 2
+
+const moneyUnit = 100
+
+var (
+	errMoneyScale    = fmt.Errorf("amount must not have more than %d decimal places", MoneyScale)
+	errMoneyOverflow = errors.New("amount is out of range")
+)
+
+// Money is an exact amount held as integer minor units (1/100). It is stored
+// as NUMERIC and marshalled as a JSON number, but also accepts JSON strings
+// so clients can avoid binary floating point entirely.
+type Money int64
+
+// ParseMoney reads a plain decimal amount such as 79, 79.5 or -12.30.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	r, ok := parseDecimal(s)
+	if !ok {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return moneyFromRat(r)
+}
+
+// parseDecimal reads digits with an optional minus sign and fraction. It
+// rejects the other forms big.Rat accepts, such as 1e2, 0x10, 0b11, 1_000,
+// 1/2 and 010, so that only what a person would read as a number is one.
+// Trailing zeros in the fraction are left for the caller's scale check.
+func parseDecimal(s string) (*big.Rat, bool) {
+	whole, fraction, hasFraction := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+	if !isDigits(whole) || len(whole) > 1 && whole[0] == '0' || hasFraction && !isDigits(fraction) {
+		return nil, false
+	}
+	return new(big.Rat).SetString(s)
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func moneyFromRat(r *big.Rat) (Money, error) {
+	r = new(big.Rat).Mul(r, big.NewRat(moneyUnit, 1))
+	if !r.IsInt() {
+		return 0, errMoneyScale
+	}
+	n := r.Num()
+	if !n.IsInt64() {
+		return 0, errMoneyOverflow
+	}
+	return Money(n.Int64()), nil
+}
+
+// MoneyFromFloat rounds f to the nearest minor unit.
+func MoneyFromFloat(f float64) Money {
+	return Money(math.Round(f * moneyUnit))
+}
+
+func (m Money) Rat() *big.Rat {
+	return big.NewRat(int64(m), moneyUnit)
+}
+
+// Add returns m+o, failing instead of wrapping around on overflow.
+func (m Money) Add(o Money) (Money, error) {
+	sum := m + o
+	if (o > 0 && sum < m) || (o < 0 && sum > m) {
+		return 0, errMoneyOverflow
+	}
+	return sum, nil
+}
+
+func SumMoney(amounts ...Money) (Money, error) {
+	var total Money
+	for _, a := range amounts {
+		var err error
+		if total, err = total.Add(a); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// String formats m without trailing zeros, so 79.00 prints as 79 and 79.50
+// as 79.5.
+func (m Money) String() string {
+	neg := m < 0
+	u := uint64(m)
+	if neg {
+		u = uint64(-m)
+	}
+	s := strconv.FormatUint(u/moneyUnit, 10)
+	if frac := u % moneyUnit; frac != 0 {
+		s += strings.TrimRight(fmt.Sprintf(".%02d", frac), "0")
+	}
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		data = []byte(s)
+	}
+	v, err := ParseMoney(string(data))
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.Rat().FloatString(MoneyScale), nil
+}
+
+func (m *Money) Scan(src interface{}) error {
+	var err error
+	switch v := src.(type) {
+	case []byte:
+		*m, err = ParseMoney(string(v))
+	case string:
+		*m, err = ParseMoney(v)
+	case int64:
+		if v > math.MaxInt64/moneyUnit || v < math.MinInt64/moneyUnit {
+			return errMoneyOverflow
+		}
+		*m = Money(v * moneyUnit)
+	case int:
+		return m.Scan(int64(v))
+	case float64:
+		*m = MoneyFromFloat(v)
+	case nil:
+		*m = 0
+	default:
+		return fmt.Errorf("can not scan %T into Money", src)
+	}
+	return err
+}
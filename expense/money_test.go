@@ -0,0 +1,92 @@
+//go:build unit
+// +build unit
+
+package expense
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMoney(t *testing.T) {
+
+	t.Run("parse money", func(t *testing.T) {
+		cases := map[string]Money{
+			"79":     7900,
+			"79.5":   7950,
+			"0.05":   5,
+			"-12.30": -1230,
+			"10.000": 1000,
+			"0":      0,
+		}
+		for in, want := range cases {
+			got, err := ParseMoney(in)
+			if assert.NoError(t, err, in) {
+				assert.Equal(t, want, got, in)
+			}
+		}
+	})
+
+	t.Run("parse money accepts only plain decimals", func(t *testing.T) {
+		for _, in := range []string{"0x10", "0b11", "0o7", "1_000", "1e2", "1E2", "010", "1/2", "+5", ".5", "5.", "-", "", "1.2.3", "1 000", "Inf", "NaN"} {
+			_, err := ParseMoney(in)
+			assert.Error(t, err, in)
+		}
+	})
+
+	t.Run("parse money rejects extra decimal places", func(t *testing.T) {
+		_, err := ParseMoney("0.001")
+
+		assert.ErrorIs(t, err, errMoneyScale)
+	})
+
+	t.Run("sum is exact", func(t *testing.T) {
+		a, _ := ParseMoney("0.1")
+		b, _ := ParseMoney("0.2")
+
+		sum, err := SumMoney(a, b)
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, "0.3", sum.String())
+		}
+	})
+
+	t.Run("sum overflow", func(t *testing.T) {
+		_, err := SumMoney(Money(1<<62), Money(1<<62))
+
+		assert.ErrorIs(t, err, errMoneyOverflow)
+	})
+
+	t.Run("json accepts numbers and strings", func(t *testing.T) {
+		var v struct {
+			A Money `json:"a"`
+			B Money `json:"b"`
+		}
+
+		err := json.Unmarshal([]byte(`{"a": 66900, "b": "0.30"}`), &v)
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, Money(6690000), v.A)
+			assert.Equal(t, Money(30), v.B)
+		}
+	})
+
+	t.Run("json marshals as number", func(t *testing.T) {
+		raw, err := json.Marshal([]Money{7900, 7950, 5, -1230})
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, `[79,79.5,0.05,-12.3]`, string(raw))
+		}
+	})
+
+	t.Run("scan numeric", func(t *testing.T) {
+		var m Money
+
+		err := m.Scan([]byte("1234.56"))
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, Money(123456), m)
+		}
+	})
+}
@@ -0,0 +1,381 @@
+package expense
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	MIMEMergePatch = "application/merge-patch+json"
+	MIMEJSONPatch  = "application/json-patch+json"
+)
+
+var errPatchTestFailed = errors.New("patch test operation failed")
+
+// PatchExpensesByIdHandler applies a partial update. Bodies sent as
+// application/merge-patch+json (or plain application/json) follow RFC 7386,
+// application/json-patch+json bodies follow RFC 6902.
+func (h *handler) PatchExpensesByIdHandler(c echo.Context) error {
+
+	owner, err := ownerID(c)
+	if err != nil {
+		return err
+	}
+
+	rowID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+
+	mediaType, _, err := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if err != nil {
+		mediaType = echo.MIMEApplicationJSON
+	}
+
+	var apply func(doc interface{}, patch []byte) (interface{}, error)
+	switch mediaType {
+	case MIMEMergePatch, echo.MIMEApplicationJSON:
+		apply = applyMergePatch
+	case MIMEJSONPatch:
+		apply = applyJSONPatch
+	default:
+		return errorJSON(c, http.StatusUnsupportedMediaType, Err{Message: "unsupported patch format: " + mediaType})
+	}
+
+	patch, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+	if !json.Valid(patch) {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: "patch body is not valid JSON"})
+	}
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	var patchErr error
+	patched, err := h.Store.Patch(ctx, owner, rowID, func(ex Expense) (Expense, error) {
+		patched, err := patchExpense(ex, patch, apply)
+		if err != nil {
+			patchErr = err
+			return ex, err
+		}
+		normalizeExpense(&patched)
+		if errs := validateExpense(patched); len(errs) > 0 {
+			return ex, &ValidationError{Errors: errs}
+		}
+		return patched, nil
+	})
+	switch {
+	case err == nil:
+	case errors.Is(patchErr, errPatchTestFailed):
+		return errorJSON(c, http.StatusConflict, Err{Message: patchErr.Error()})
+	case patchErr != nil:
+		return errorJSON(c, http.StatusUnprocessableEntity, Err{Message: patchErr.Error()})
+	default:
+		return storeError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, patched)
+}
+
+// patchExpense round-trips ex through its JSON form so that patches address
+// the same field names clients see. The id can not be changed by a patch.
+func patchExpense(ex Expense, patch []byte, apply func(doc interface{}, patch []byte) (interface{}, error)) (Expense, error) {
+	raw, err := json.Marshal(ex)
+	if err != nil {
+		return ex, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return ex, err
+	}
+
+	doc, err = apply(doc, patch)
+	if err != nil {
+		return ex, err
+	}
+
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return ex, errors.New("patched expense must be a JSON object")
+	}
+	if id, ok := obj["id"].(float64); !ok || int(id) != ex.ID {
+		return ex, errors.New("id can not be patched")
+	}
+
+	raw, err = json.Marshal(obj)
+	if err != nil {
+		return ex, err
+	}
+	patched := Expense{}
+	if err := json.Unmarshal(raw, &patched); err != nil {
+		return ex, err
+	}
+	return patched, nil
+}
+
+func applyMergePatch(doc interface{}, patch []byte) (interface{}, error) {
+	var p interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, err
+	}
+	return mergePatch(doc, p), nil
+}
+
+// mergePatch implements the MergePatch algorithm from RFC 7386 section 2.
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+type patchOperation struct {
+	Op    string           `json:"op"`
+	Path  string           `json:"path"`
+	From  string           `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+func applyJSONPatch(doc interface{}, patch []byte) (interface{}, error) {
+	var ops []patchOperation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		var err error
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fmt.Errorf("operation %d: %s requires a value", i, op.Op)
+			}
+			var value interface{}
+			if err := json.Unmarshal(*op.Value, &value); err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+			switch op.Op {
+			case "add":
+				doc, err = pointerAdd(doc, op.Path, value)
+			case "replace":
+				if _, err = pointerGet(doc, op.Path); err == nil {
+					doc, _, err = pointerRemove(doc, op.Path)
+				}
+				if err == nil {
+					doc, err = pointerAdd(doc, op.Path, value)
+				}
+			case "test":
+				var current interface{}
+				current, err = pointerGet(doc, op.Path)
+				if err == nil && !jsonEqual(current, value) {
+					err = fmt.Errorf("%w at %s", errPatchTestFailed, op.Path)
+				}
+			}
+		case "remove":
+			doc, _, err = pointerRemove(doc, op.Path)
+		case "move", "copy":
+			var value interface{}
+			value, err = pointerGet(doc, op.From)
+			if err == nil && op.Op == "move" {
+				if strings.HasPrefix(op.Path, op.From+"/") {
+					err = errors.New("can not move a value into one of its children")
+				} else {
+					doc, _, err = pointerRemove(doc, op.From)
+				}
+			}
+			if err == nil {
+				doc, err = pointerAdd(doc, op.Path, value)
+			}
+		default:
+			err = fmt.Errorf("unknown op %q", op.Op)
+		}
+		if err != nil {
+			if errors.Is(err, errPatchTestFailed) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+	return doc, nil
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into unescaped tokens.
+func parsePointer(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", path)
+	}
+	tokens := strings.Split(path[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	max := length - 1
+	if allowEnd {
+		max = length
+	}
+	if i > max {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+func pointerGet(doc interface{}, path string) (interface{}, error) {
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tokens {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[t]
+			if !ok {
+				return nil, fmt.Errorf("path %s does not exist", path)
+			}
+			doc = v
+		case []interface{}:
+			i, err := arrayIndex(t, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("path %s does not exist", path)
+		}
+	}
+	return doc, nil
+}
+
+func pointerAdd(doc interface{}, path string, value interface{}) (interface{}, error) {
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	parentPath := path[:strings.LastIndex(path, "/")]
+	parent, err := pointerGet(doc, parentPath)
+	if err != nil {
+		return nil, err
+	}
+	last := tokens[len(tokens)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+		return doc, nil
+	case []interface{}:
+		i, err := arrayIndex(last, len(node), true)
+		if err != nil {
+			return nil, err
+		}
+		node = append(node, nil)
+		copy(node[i+1:], node[i:])
+		node[i] = value
+		return pointerReplaceNode(doc, parentPath, node)
+	default:
+		return nil, fmt.Errorf("path %s does not exist", parentPath)
+	}
+}
+
+func pointerRemove(doc interface{}, path string) (interface{}, interface{}, error) {
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, doc, nil
+	}
+	parentPath := path[:strings.LastIndex(path, "/")]
+	parent, err := pointerGet(doc, parentPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	last := tokens[len(tokens)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		v, ok := node[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("path %s does not exist", path)
+		}
+		delete(node, last)
+		return doc, v, nil
+	case []interface{}:
+		i, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		v := node[i]
+		node = append(node[:i:i], node[i+1:]...)
+		doc, err = pointerReplaceNode(doc, parentPath, node)
+		return doc, v, err
+	default:
+		return nil, nil, fmt.Errorf("path %s does not exist", path)
+	}
+}
+
+// pointerReplaceNode stores a resized array back into its parent, since
+// growing or shrinking a slice may not be visible through the old header.
+func pointerReplaceNode(doc interface{}, path string, value interface{}) (interface{}, error) {
+	if path == "" {
+		return value, nil
+	}
+	parentPath := path[:strings.LastIndex(path, "/")]
+	parent, err := pointerGet(doc, parentPath)
+	if err != nil {
+		return nil, err
+	}
+	tokens, _ := parsePointer(path)
+	last := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+	case []interface{}:
+		i, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = value
+	}
+	return doc, nil
+}
+
+func jsonEqual(a, b interface{}) bool {
+	ra, errA := json.Marshal(a)
+	rb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ra) == string(rb)
+}
@@ -0,0 +1,146 @@
+//go:build unit
+// +build unit
+
+package expense
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPatchExpense(t *testing.T) {
+	current := Expense{
+		ID:     1,
+		Title:  "strawberry smoothie",
+		Amount: 7900,
+		Note:   "night market promotion discount 10 bath",
+		Tags:   []string{"food", "beverage"},
+	}
+
+	t.Run("merge patch only touches supplied fields", func(t *testing.T) {
+		got, err := patchExpense(current, []byte(`{"note":"x"}`), applyMergePatch)
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, "strawberry smoothie", got.Title)
+			assert.Equal(t, Money(7900), got.Amount)
+			assert.Equal(t, "x", got.Note)
+			assert.Equal(t, []string{"food", "beverage"}, got.Tags)
+		}
+	})
+
+	t.Run("merge patch null removes a field", func(t *testing.T) {
+		got, err := patchExpense(current, []byte(`{"note":null,"tags":["gadget"]}`), applyMergePatch)
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, "", got.Note)
+			assert.Equal(t, []string{"gadget"}, got.Tags)
+		}
+	})
+
+	t.Run("json patch adds and removes tags", func(t *testing.T) {
+		patch := `[
+			{"op": "test", "path": "/tags/0", "value": "food"},
+			{"op": "remove", "path": "/tags/0"},
+			{"op": "add", "path": "/tags/-", "value": "night market"},
+			{"op": "replace", "path": "/amount", "value": 89}
+		]`
+		got, err := patchExpense(current, []byte(patch), applyJSONPatch)
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, []string{"beverage", "night market"}, got.Tags)
+			assert.Equal(t, Money(8900), got.Amount)
+			assert.Equal(t, "strawberry smoothie", got.Title)
+		}
+	})
+
+	t.Run("json patch failed test", func(t *testing.T) {
+		_, err := patchExpense(current, []byte(`[{"op": "test", "path": "/title", "value": "coffee"}]`), applyJSONPatch)
+
+		assert.ErrorIs(t, err, errPatchTestFailed)
+	})
+
+	t.Run("id can not be patched", func(t *testing.T) {
+		_, err := patchExpense(current, []byte(`{"id": 2}`), applyMergePatch)
+
+		assert.Error(t, err)
+	})
+}
+
+func TestPatchExpensesById(t *testing.T) {
+
+	t.Run("merge patch expense success", func(t *testing.T) {
+		id := 1
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(`{"note": "no discount"}`))
+		req.Header.Set(echo.HeaderContentType, MIMEMergePatch)
+		rec := httptest.NewRecorder()
+
+		mockedRow := sqlmock.NewRows(expenseTestColumns).
+			AddRow(1, "apple smoothie", 89, "THB", "promotion", pq.Array([]string{"beverage"}), testTime, testTime, testTime)
+
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id,title, amount, currency, note, tags, spent_at, created_at, updated_at FROM expenses WHERE id=$1 AND owner_id=$2 AND deleted_at IS NULL FOR UPDATE").
+			WithArgs(id, "alice").
+			WillReturnRows(mockedRow)
+		mock.ExpectQuery("UPDATE expenses SET title=$2 , amount=$3, currency=$4, note=$5, tags=$6, spent_at=COALESCE($7, spent_at), updated_at=now() WHERE id=$1 RETURNING id,title, amount, currency, note, tags, spent_at, created_at, updated_at").
+			WithArgs(id, "apple smoothie", Money(8900), "THB", "no discount", pq.Array([]string{"beverage"}), testTime).
+			WillReturnRows(sqlmock.NewRows(expenseTestColumns).
+				AddRow(1, "apple smoothie", 89, "THB", "no discount", pq.Array([]string{"beverage"}), testTime, testTime, testTime))
+		mock.ExpectCommit()
+		h := handler{Store: NewPostgresStore(db)}
+
+		c := withOwner(e.NewContext(req, rec))
+		c.SetPath("/:id")
+		c.SetParamNames("id")
+		c.SetParamValues(strconv.Itoa(id))
+		expected := "{\"id\":1,\"title\":\"apple smoothie\",\"amount\":89,\"currency\":\"THB\",\"note\":\"no discount\",\"tags\":[\"beverage\"]," + testTimestamps + "}"
+
+		// Act
+		err = h.PatchExpensesByIdHandler(c)
+
+		// Assertions
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, expected, strings.TrimSpace(rec.Body.String()))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		}
+	})
+
+	t.Run("patch unsupported media type", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(`note=x`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+
+		db, _, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := handler{Store: NewPostgresStore(db)}
+
+		c := withOwner(e.NewContext(req, rec))
+		c.SetPath("/:id")
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+
+		// Act
+		err = h.PatchExpensesByIdHandler(c)
+
+		// Assertions
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+		}
+	})
+}
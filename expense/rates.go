@@ -0,0 +1,348 @@
+package expense
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// ExchangeRate says that on and after EffectiveDate one unit of Base buys
+// Rate units of Quote.
+type ExchangeRate struct {
+	ID            int    `json:"id"`
+	Base          string `json:"base"`
+	Quote         string `json:"quote"`
+	Rate          Rate   `json:"rate"`
+	EffectiveDate string `json:"effective_date"`
+}
+
+// Rate is an exact positive decimal exchange rate.
+type Rate struct {
+	r *big.Rat
+}
+
+func (r Rate) Rat() *big.Rat {
+	return r.r
+}
+
+// RateScale is the number of decimal places a rate may carry.
+const RateScale = 10
+
+var rateUnit = new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(RateScale), nil))
+
+// ParseRate reads a positive plain decimal such as 35 or 0.0285.
+func ParseRate(s string) (Rate, error) {
+	s = strings.TrimSpace(s)
+	r, ok := parseDecimal(s)
+	if !ok || r.Sign() <= 0 {
+		return Rate{}, fmt.Errorf("invalid rate %q", s)
+	}
+	if !new(big.Rat).Mul(r, rateUnit).IsInt() {
+		return Rate{}, fmt.Errorf("rate %q must not have more than %d decimal places", s, RateScale)
+	}
+	return Rate{r: r}, nil
+}
+
+func (r Rate) String() string {
+	if r.r == nil {
+		return "0"
+	}
+	s := r.r.FloatString(RateScale)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		data = []byte(s)
+	}
+	v, err := ParseRate(string(data))
+	if err != nil {
+		return err
+	}
+	*r = v
+	return nil
+}
+
+func (r Rate) Value() (driver.Value, error) {
+	return r.String(), nil
+}
+
+func (r *Rate) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return r.scanString(string(v))
+	case string:
+		return r.scanString(v)
+	case float64:
+		*r = Rate{r: new(big.Rat).SetFloat64(v)}
+		return nil
+	case int64:
+		*r = Rate{r: big.NewRat(v, 1)}
+		return nil
+	default:
+		return fmt.Errorf("can not scan %T into Rate", src)
+	}
+}
+
+func (r *Rate) scanString(s string) error {
+	v, err := ParseRate(s)
+	if err != nil {
+		return err
+	}
+	*r = v
+	return nil
+}
+
+func (rate *ExchangeRate) normalize() error {
+	var err error
+	if rate.Base, err = normalizeCurrency(rate.Base); err != nil {
+		return err
+	}
+	if rate.Quote, err = normalizeCurrency(rate.Quote); err != nil {
+		return err
+	}
+	if rate.Base == rate.Quote {
+		return errors.New("base and quote currency must differ")
+	}
+	if rate.Rate.r == nil || rate.Rate.r.Sign() <= 0 {
+		return errors.New("rate must be positive")
+	}
+	if _, err := time.Parse(dateLayout, rate.EffectiveDate); err != nil {
+		return fmt.Errorf("effective_date must be a date (%s)", dateLayout)
+	}
+	return nil
+}
+
+func (h *handler) CreateRateHandler(c echo.Context) error {
+	var rate ExchangeRate
+	if err := c.Bind(&rate); err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+	if err := rate.normalize(); err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	rates, err := h.Store.UpsertRates(ctx, []ExchangeRate{rate})
+	if err != nil {
+		return storeError(c, err)
+	}
+	return c.JSON(http.StatusCreated, rates[0])
+}
+
+func (h *handler) GetRatesHandler(c echo.Context) error {
+	var filter [2]string
+	for i, param := range []string{"base", "quote"} {
+		if v := c.QueryParam(param); v != "" {
+			code, err := normalizeCurrency(v)
+			if err != nil {
+				return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+			}
+			filter[i] = code
+		}
+	}
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	rates, err := h.Store.ListRates(ctx, filter[0], filter[1])
+	if err != nil {
+		return storeError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, rates)
+}
+
+func (h *handler) DeleteRateHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	if err := h.Store.DeleteRate(ctx, id); err != nil {
+		return storeError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ImportRatesHandler upserts rates from a CSV with the header
+// base,quote,rate,effective_date, sent either as the multipart field "file"
+// or as the raw request body. Either every row is stored or none is.
+func (h *handler) ImportRatesHandler(c echo.Context) error {
+	body, err := csvUpload(c)
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+	defer body.Close()
+
+	rates, err := parseRatesCSV(body)
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	rates, err = h.Store.UpsertRates(ctx, rates)
+	if err != nil {
+		return storeError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, rates)
+}
+
+func parseRatesCSV(r io.Reader) ([]ExchangeRate, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %w", err)
+	}
+	cols := map[string]int{}
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"base", "quote", "rate", "effective_date"} {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("csv header is missing column %q", name)
+		}
+	}
+
+	var rates []ExchangeRate
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		rate := ExchangeRate{
+			Base:          record[cols["base"]],
+			Quote:         record[cols["quote"]],
+			EffectiveDate: strings.TrimSpace(record[cols["effective_date"]]),
+		}
+		if rate.Rate, err = ParseRate(record[cols["rate"]]); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := rate.normalize(); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rates = append(rates, rate)
+	}
+	if len(rates) == 0 {
+		return nil, errors.New("csv contains no rates")
+	}
+	return rates, nil
+}
+
+var errNoRate = errors.New("no exchange rate")
+
+// rateTable holds the stored rates to or from one currency, so that the
+// expenses of a response are converted with a single read of the rates.
+type rateTable struct {
+	to    string
+	rates []ExchangeRate
+}
+
+// loadRates reads every rate that can convert an expense into to.
+func (h *handler) loadRates(ctx context.Context, to string) (rateTable, error) {
+	into, err := h.Store.ListRates(ctx, "", to)
+	if err != nil {
+		return rateTable{}, err
+	}
+	from, err := h.Store.ListRates(ctx, to, "")
+	if err != nil {
+		return rateTable{}, err
+	}
+	return rateTable{to: to, rates: append(into, from...)}, nil
+}
+
+// lookup finds the rate from a currency into t.to that was effective on the
+// given day, as Store.FindRate would: the latest one, in either direction,
+// preferring the direct pair on the same day.
+func (t rateTable) lookup(from string, on time.Time) (*big.Rat, error) {
+	if from == t.to {
+		return big.NewRat(1, 1), nil
+	}
+
+	day := on.Format(dateLayout)
+	var found *ExchangeRate
+	for i, r := range t.rates {
+		direct := r.Base == from
+		if r.Base != from && r.Quote != from || r.EffectiveDate > day {
+			continue
+		}
+		if found == nil || r.EffectiveDate > found.EffectiveDate || (r.EffectiveDate == found.EffectiveDate && direct) {
+			found = &t.rates[i]
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%w from %s to %s on %s", errNoRate, from, t.to, day)
+	}
+	return rateFor(from, *found), nil
+}
+
+// convertExpense rewrites ex in the currency of rates, keeping the original
+// amount and currency alongside.
+func convertExpense(ex *Expense, rates rateTable) error {
+	if ex.Currency == rates.to {
+		return nil
+	}
+	on := time.Now()
+	if ex.SpentAt != nil {
+		on = *ex.SpentAt
+	}
+	rate, err := rates.lookup(ex.Currency, on)
+	if err != nil {
+		return err
+	}
+	converted, err := ex.Amount.Convert(rate, rates.to)
+	if err != nil {
+		return err
+	}
+
+	original, originalCurrency := ex.Amount, ex.Currency
+	ex.OriginalAmount = &original
+	ex.OriginalCurrency = originalCurrency
+	ex.Amount = converted
+	ex.Currency = rates.to
+	return nil
+}
+
+// convertParam reads the optional ?currency= target of a read request.
+func convertParam(c echo.Context) (string, error) {
+	v := c.QueryParam("currency")
+	if v == "" {
+		return "", nil
+	}
+	return normalizeCurrency(v)
+}
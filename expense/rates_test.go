@@ -0,0 +1,239 @@
+//go:build unit
+// +build unit
+
+package expense
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCurrency(t *testing.T) {
+
+	t.Run("default currency", func(t *testing.T) {
+		ex := Expense{Title: "coffee", Amount: 7900}
+
+		normalizeExpense(&ex)
+
+		assert.Equal(t, "THB", ex.Currency)
+		assert.Empty(t, validateExpense(ex))
+	})
+
+	t.Run("yen has no minor units", func(t *testing.T) {
+		ex := Expense{Title: "ramen", Amount: 1050, Currency: "jpy"}
+		normalizeExpense(&ex)
+
+		errs := validateExpense(ex)
+
+		assert.Equal(t, []FieldError{{Field: "amount", Code: CodeScale, Message: "JPY amounts must not have more than 0 decimal places"}}, errs)
+	})
+
+	t.Run("unknown currency", func(t *testing.T) {
+		ex := Expense{Title: "ramen", Amount: 100, Currency: "XYZ"}
+		normalizeExpense(&ex)
+
+		errs := validateExpense(ex)
+
+		if assert.Len(t, errs, 1) {
+			assert.Equal(t, "currency", errs[0].Field)
+			assert.Equal(t, CodeInvalid, errs[0].Code)
+		}
+	})
+
+	t.Run("convert rounds half away from zero", func(t *testing.T) {
+		got, err := Money(1001).Convert(big.NewRat(1, 2), "THB")
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, Money(501), got)
+		}
+	})
+
+	t.Run("convert to currency without minor units", func(t *testing.T) {
+		rate, _ := ParseRate("4.1")
+
+		got, err := Money(1099).Convert(rate.Rat(), "JPY")
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, Money(4500), got)
+		}
+	})
+}
+
+func TestParseRate(t *testing.T) {
+
+	t.Run("plain decimals", func(t *testing.T) {
+		for in, want := range map[string]string{"35": "35", "0.0285": "0.0285", "35.0000000000": "35", "0.0000000001": "0.0000000001"} {
+			rate, err := ParseRate(in)
+			if assert.NoError(t, err, in) {
+				assert.Equal(t, want, rate.String(), in)
+			}
+		}
+	})
+
+	t.Run("other forms are rejected", func(t *testing.T) {
+		for _, in := range []string{"0x1", "0b1", "1_0", "1e2", "035", "1/3", "0", "-1", "0.00000000001", ""} {
+			_, err := ParseRate(in)
+			assert.Error(t, err, in)
+		}
+	})
+}
+
+func TestParseRatesCSV(t *testing.T) {
+
+	t.Run("parse rates", func(t *testing.T) {
+		csv := "base,quote,rate,effective_date\nusd,THB,34.5,2022-12-01\nJPY,THB,0.2541,2022-12-01\n"
+
+		rates, err := parseRatesCSV(strings.NewReader(csv))
+
+		if assert.NoError(t, err) && assert.Len(t, rates, 2) {
+			assert.Equal(t, "USD", rates[0].Base)
+			assert.Equal(t, "34.5", rates[0].Rate.String())
+			assert.Equal(t, "0.2541", rates[1].Rate.String())
+		}
+	})
+
+	t.Run("reports the failing line", func(t *testing.T) {
+		csv := "base,quote,rate,effective_date\nUSD,THB,34.5,2022-12-01\nUSD,THB,-1,2022-12-02\n"
+
+		_, err := parseRatesCSV(strings.NewReader(csv))
+
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "line 3")
+		}
+	})
+
+	t.Run("rejects rates that are not plain decimals", func(t *testing.T) {
+		csv := "base,quote,rate,effective_date\nUSD,THB,0x1,2022-12-01\n"
+
+		_, err := parseRatesCSV(strings.NewReader(csv))
+
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "line 2")
+		}
+	})
+}
+
+func TestGetExpensesByIdConverted(t *testing.T) {
+
+	t.Run("convert expense to requested currency", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/expenses/1?currency=thb", nil)
+		rec := httptest.NewRecorder()
+
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mock.ExpectQuery("SELECT id,title, amount, currency, note, tags, spent_at, created_at, updated_at FROM expenses WHERE id=$1 AND owner_id=$2 AND deleted_at IS NULL").
+			WithArgs(1, "alice").
+			WillReturnRows(sqlmock.NewRows(expenseTestColumns).
+				AddRow(1, "ramen", "12.50", "USD", "", pq.Array([]string{"food"}), testTime, testTime, testTime))
+		mock.ExpectQuery("SELECT id, base, quote, rate, effective_date FROM exchange_rates WHERE quote = $1 ORDER BY base, quote, effective_date DESC").
+			WithArgs("THB").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "base", "quote", "rate", "effective_date"}))
+		mock.ExpectQuery("SELECT id, base, quote, rate, effective_date FROM exchange_rates WHERE base = $1 ORDER BY base, quote, effective_date DESC").
+			WithArgs("THB").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "base", "quote", "rate", "effective_date"}).
+				AddRow(1, "THB", "USD", "0.0290000000", testTime))
+		h := handler{Store: NewPostgresStore(db)}
+
+		c := withOwner(e.NewContext(req, rec))
+		c.SetPath("/expenses/:id")
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+		expected := "{\"id\":1,\"title\":\"ramen\",\"amount\":431.03,\"currency\":\"THB\",\"note\":\"\",\"tags\":[\"food\"]," + testTimestamps + ",\"original_amount\":12.5,\"original_currency\":\"USD\"}"
+
+		// Act
+		err = h.GetExpensesByIdHandler(c)
+
+		// Assertions
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, expected, strings.TrimSpace(rec.Body.String()))
+		}
+	})
+}
+
+// rateCountingStore counts the reads of exchange rates.
+type rateCountingStore struct {
+	*MemoryStore
+	reads *int
+}
+
+func (s rateCountingStore) ListRates(ctx context.Context, base, quote string) ([]ExchangeRate, error) {
+	*s.reads++
+	return s.MemoryStore.ListRates(ctx, base, quote)
+}
+
+func (s rateCountingStore) FindRate(ctx context.Context, base, quote string, on time.Time) (ExchangeRate, error) {
+	*s.reads++
+	return s.MemoryStore.FindRate(ctx, base, quote, on)
+}
+
+func TestGetExpensesConverted(t *testing.T) {
+
+	t.Run("rates are read once for the whole list", func(t *testing.T) {
+		ctx := context.Background()
+		store := NewMemoryStore()
+		day := func(d string) *time.Time {
+			at, _ := time.Parse(dateLayout, d)
+			return &at
+		}
+		older, _ := ParseRate("35")
+		newer, _ := ParseRate("0.025")
+		_, err := store.UpsertRates(ctx, []ExchangeRate{
+			{Base: "USD", Quote: "THB", Rate: older, EffectiveDate: "2022-12-01"},
+			{Base: "THB", Quote: "USD", Rate: newer, EffectiveDate: "2023-01-01"},
+			{Base: "USD", Quote: "EUR", Rate: older, EffectiveDate: "2022-12-01"},
+		})
+		assert.NoError(t, err)
+		for _, ex := range []Expense{
+			{Title: "bagel", Amount: 400, Currency: "USD", SpentAt: day("2022-12-24")},
+			{Title: "pizza", Amount: 1000, Currency: "USD", SpentAt: day("2023-01-02")},
+			{Title: "noodles", Amount: 5000, Currency: "THB", SpentAt: day("2023-01-02")},
+		} {
+			_, err := store.Create(ctx, "alice", ex)
+			assert.NoError(t, err)
+		}
+		reads := 0
+		h := NewHandler(rateCountingStore{store, &reads})
+
+		rec := storeRequest(t, h, http.MethodGet, "/expenses?currency=THB&sort=id", "", (*handler).GetExpensesHandler)
+
+		var got []Expense
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		amounts := []string{}
+		for _, ex := range got {
+			amounts = append(amounts, ex.Amount.String()+" "+ex.Currency)
+		}
+		assert.Equal(t, []string{"140 THB", "400 THB", "50 THB"}, amounts)
+		assert.Equal(t, 2, reads)
+	})
+}
+
+func TestRateWritesNeedAdmin(t *testing.T) {
+	e := echo.New()
+	g := e.Group("", Authenticate(LegacyAuthenticator{}))
+	h := NewHandler(NewMemoryStore())
+	g.POST("/rates", h.CreateRateHandler, RequireAdmin([]string{"root"}))
+
+	req := httptest.NewRequest(http.MethodPost, "/rates", strings.NewReader(`{"base": "USD", "quote": "THB", "rate": 35, "effective_date": "2023-01-01"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderAuthorization, legacyToken)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rates, _ := h.Store.ListRates(context.Background(), "", "")
+	assert.Empty(t, rates)
+}
@@ -0,0 +1,292 @@
+package expense
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+	FrequencyYearly  = "yearly"
+
+	maxRecurringInterval = 1000
+)
+
+// Recurring is a template for an expense that is created on a schedule: every
+// Interval days, weeks, months or years from StartsAt, until EndsAt if set.
+// Monthly and yearly runs fall on DayOfMonth, or on the day of StartsAt, and
+// on the last day of shorter months. LastRun is the run most recently
+// created and NextRun the one due next, or nil once the schedule has ended.
+type Recurring struct {
+	ID         int        `json:"id"`
+	Title      string     `json:"title"`
+	Amount     Money      `json:"amount"`
+	Currency   string     `json:"currency"`
+	Note       string     `json:"note"`
+	Tags       []string   `json:"tags"`
+	Frequency  string     `json:"frequency"`
+	Interval   int        `json:"interval"`
+	DayOfMonth int        `json:"day_of_month,omitempty"`
+	StartsAt   time.Time  `json:"starts_at"`
+	EndsAt     *time.Time `json:"ends_at,omitempty"`
+	LastRun    *time.Time `json:"last_run,omitempty"`
+	NextRun    *time.Time `json:"next_run,omitempty"`
+}
+
+// expense is the expense created by the run at.
+func (r Recurring) expense(at time.Time) Expense {
+	return Expense{
+		Title:    r.Title,
+		Amount:   r.Amount,
+		Currency: r.Currency,
+		Note:     r.Note,
+		Tags:     append([]string{}, r.Tags...),
+		SpentAt:  &at,
+	}
+}
+
+// occurrence returns run k of the schedule, counted from StartsAt. It may be
+// earlier than StartsAt when DayOfMonth is.
+func (r Recurring) occurrence(k int) time.Time {
+	start := r.StartsAt.UTC()
+	n := k * r.Interval
+	switch r.Frequency {
+	case FrequencyDaily:
+		return start.AddDate(0, 0, n)
+	case FrequencyWeekly:
+		return start.AddDate(0, 0, 7*n)
+	}
+
+	year, month := start.Year(), int(start.Month())-1
+	if r.Frequency == FrequencyYearly {
+		year += n
+	} else {
+		month += n
+	}
+	year, month = year+month/12, month%12+1
+	day := r.DayOfMonth
+	if day == 0 {
+		day = start.Day()
+	}
+	if last := time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Day(); day > last {
+		day = last
+	}
+	return time.Date(year, time.Month(month), day, start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), time.UTC)
+}
+
+// firstFrom returns the first run at or after t, or nil if the schedule ends
+// before it.
+func (r Recurring) firstFrom(t time.Time) *time.Time {
+	start := r.StartsAt.UTC()
+	if t.Before(start) {
+		t = start
+	}
+
+	// Start a little before t so that clamped days can not be skipped.
+	var units int
+	switch r.Frequency {
+	case FrequencyDaily:
+		units = int(t.Sub(start) / (24 * time.Hour))
+	case FrequencyWeekly:
+		units = int(t.Sub(start) / (7 * 24 * time.Hour))
+	case FrequencyMonthly:
+		units = (t.Year()-start.Year())*12 + int(t.Month()) - int(start.Month())
+	case FrequencyYearly:
+		units = t.Year() - start.Year()
+	}
+	k := units/r.Interval - 1
+	if k < 0 {
+		k = 0
+	}
+
+	for ; ; k++ {
+		if occ := r.occurrence(k); !occ.Before(t) {
+			if r.EndsAt != nil && occ.After(*r.EndsAt) {
+				return nil
+			}
+			return &occ
+		}
+	}
+}
+
+// reschedule sets NextRun to the first run after LastRun.
+func (r *Recurring) reschedule() {
+	from := r.StartsAt
+	if r.LastRun != nil && !r.LastRun.Before(from) {
+		from = r.LastRun.Add(time.Nanosecond)
+	}
+	r.NextRun = r.firstFrom(from)
+}
+
+// normalizeRecurring applies the defaults. Times are kept to the second, as
+// every store can hold them exactly.
+func normalizeRecurring(r *Recurring, now time.Time) {
+	ex := r.expense(time.Time{})
+	normalizeExpense(&ex)
+	r.Title, r.Currency, r.Tags = ex.Title, ex.Currency, ex.Tags
+	r.Frequency = strings.ToLower(strings.TrimSpace(r.Frequency))
+	if r.Interval == 0 {
+		r.Interval = 1
+	}
+	if r.StartsAt.IsZero() {
+		r.StartsAt = now
+	}
+	r.StartsAt = r.StartsAt.UTC().Truncate(time.Second)
+	if r.EndsAt != nil {
+		end := r.EndsAt.UTC().Truncate(time.Second)
+		r.EndsAt = &end
+	}
+	r.LastRun, r.NextRun = nil, nil
+}
+
+func validateRecurring(r Recurring) []FieldError {
+	errs := validateExpense(r.expense(r.StartsAt))
+	add := func(field, code, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch r.Frequency {
+	case FrequencyDaily, FrequencyWeekly:
+		if r.DayOfMonth != 0 {
+			add("day_of_month", CodeInvalid, "day_of_month only applies to monthly and yearly schedules")
+		}
+	case FrequencyMonthly, FrequencyYearly:
+		if r.DayOfMonth < 0 || r.DayOfMonth > 31 {
+			add("day_of_month", CodeInvalid, "day_of_month must be between 1 and 31")
+		}
+	case "":
+		add("frequency", CodeRequired, "frequency is required")
+	default:
+		add("frequency", CodeInvalid, "frequency must be daily, weekly, monthly or yearly")
+	}
+
+	if r.Interval < 1 {
+		add("interval", CodeMin, "interval must be at least 1")
+	} else if r.Interval > maxRecurringInterval {
+		add("interval", CodeMax, "interval must be at most %d", maxRecurringInterval)
+	}
+
+	if r.EndsAt != nil && r.EndsAt.Before(r.StartsAt) {
+		add("ends_at", CodeInvalid, "ends_at must not be before starts_at")
+	}
+
+	return errs
+}
+
+func (h *handler) CreateRecurringHandler(c echo.Context) error {
+	owner, err := ownerID(c)
+	if err != nil {
+		return err
+	}
+	var r Recurring
+	if err := c.Bind(&r); err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+	normalizeRecurring(&r, time.Now())
+	if errs := validateRecurring(r); len(errs) > 0 {
+		return errorJSON(c, http.StatusUnprocessableEntity, validationErr(errs))
+	}
+	r.reschedule()
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	r, err = h.Store.CreateRecurring(ctx, owner, r)
+	if err != nil {
+		return storeError(c, err)
+	}
+	return c.JSON(http.StatusCreated, r)
+}
+
+func (h *handler) GetRecurringListHandler(c echo.Context) error {
+	owner, err := ownerID(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	list, err := h.Store.ListRecurring(ctx, owner)
+	if err != nil {
+		return storeError(c, err)
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+func (h *handler) GetRecurringByIdHandler(c echo.Context) error {
+	owner, err := ownerID(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	r, err := h.Store.GetRecurring(ctx, owner, id)
+	if err != nil {
+		return storeError(c, err)
+	}
+	return c.JSON(http.StatusOK, r)
+}
+
+// UpdateRecurringByIdHandler replaces a template. Runs already created are
+// kept and the new schedule picks up after the last of them.
+func (h *handler) UpdateRecurringByIdHandler(c echo.Context) error {
+	owner, err := ownerID(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+	var r Recurring
+	if err := c.Bind(&r); err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+	normalizeRecurring(&r, time.Now())
+	if errs := validateRecurring(r); len(errs) > 0 {
+		return errorJSON(c, http.StatusUnprocessableEntity, validationErr(errs))
+	}
+	r.ID = id
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	r, err = h.Store.UpdateRecurring(ctx, owner, r)
+	if err != nil {
+		return storeError(c, err)
+	}
+	return c.JSON(http.StatusOK, r)
+}
+
+// DeleteRecurringByIdHandler stops a schedule. The expenses it created stay.
+func (h *handler) DeleteRecurringByIdHandler(c echo.Context) error {
+	owner, err := ownerID(c)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	if err := h.Store.DeleteRecurring(ctx, owner, id); err != nil {
+		return storeError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,71 @@
+//go:build unit
+// +build unit
+
+package expense
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func runs(r Recurring, n int) []string {
+	var dates []string
+	r.reschedule()
+	for r.NextRun != nil && len(dates) < n {
+		dates = append(dates, r.NextRun.Format("2006-01-02 15:04"))
+		r.LastRun = r.NextRun
+		r.reschedule()
+	}
+	return dates
+}
+
+func TestRecurringSchedule(t *testing.T) {
+	start := time.Date(2023, 1, 31, 9, 0, 0, 0, time.UTC)
+
+	t.Run("monthly runs fall back to the last day of short months", func(t *testing.T) {
+		r := Recurring{Frequency: FrequencyMonthly, Interval: 1, StartsAt: start}
+		assert.Equal(t, []string{"2023-01-31 09:00", "2023-02-28 09:00", "2023-03-31 09:00", "2023-04-30 09:00"}, runs(r, 4))
+	})
+
+	t.Run("day of month may come before the start", func(t *testing.T) {
+		r := Recurring{Frequency: FrequencyMonthly, Interval: 2, DayOfMonth: 15, StartsAt: start}
+		assert.Equal(t, []string{"2023-03-15 09:00", "2023-05-15 09:00", "2023-07-15 09:00"}, runs(r, 3))
+	})
+
+	t.Run("yearly runs keep to leap days where they exist", func(t *testing.T) {
+		r := Recurring{Frequency: FrequencyYearly, Interval: 1, StartsAt: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)}
+		assert.Equal(t, []string{"2024-02-29 00:00", "2025-02-28 00:00", "2026-02-28 00:00", "2027-02-28 00:00", "2028-02-29 00:00"}, runs(r, 5))
+	})
+
+	t.Run("schedules stop after their end", func(t *testing.T) {
+		end := start.AddDate(0, 0, 21)
+		r := Recurring{Frequency: FrequencyWeekly, Interval: 2, StartsAt: start, EndsAt: &end}
+		assert.Equal(t, []string{"2023-01-31 09:00", "2023-02-14 09:00"}, runs(r, 10))
+	})
+
+	t.Run("the first run after a long gap is found directly", func(t *testing.T) {
+		r := Recurring{Frequency: FrequencyDaily, Interval: 3, StartsAt: start}
+		assert.Equal(t, "2026-02-05 09:00", r.firstFrom(time.Date(2026, 2, 3, 12, 0, 0, 0, time.UTC)).Format("2006-01-02 15:04"))
+	})
+
+	t.Run("templates are validated like expenses", func(t *testing.T) {
+		r := Recurring{Title: "rent", Amount: 1200000, Frequency: "fortnightly", Interval: -1, DayOfMonth: 40}
+		normalizeRecurring(&r, start)
+		end := start.Add(-time.Hour)
+		r.EndsAt = &end
+		var fields []string
+		for _, e := range validateRecurring(r) {
+			fields = append(fields, e.Field+":"+e.Code)
+		}
+		assert.Equal(t, []string{"frequency:invalid", "interval:min", "ends_at:invalid"}, fields)
+
+		r = Recurring{Frequency: FrequencyDaily, DayOfMonth: 1}
+		normalizeRecurring(&r, start)
+		fields = nil
+		for _, e := range validateRecurring(r) {
+			fields = append(fields, e.Field+":"+e.Code)
+		}
+		assert.Equal(t, []string{"title:required", "amount:min", "day_of_month:invalid"}, fields)
+	})
+}
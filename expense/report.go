@@ -0,0 +1,225 @@
+package expense
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	GroupByTag  = "tag"
+	PeriodDay   = "day"
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+	PeriodYear  = "year"
+)
+
+// ReportQuery aggregates the expenses matching Filter, which is read like
+// the filters of a listing. Rows are grouped by tag if Tag is set, by the
+// Period of spent_at if it is set, and always by currency, since amounts in
+// different currencies do not add up.
+type ReportQuery struct {
+	Filter ListQuery
+	Tag    bool
+	Period string
+}
+
+// SummaryRow holds the aggregates of one group. An expense with several
+// tags counts once under each of them; untagged expenses are grouped under
+// an empty tag. Period is the first day of the period.
+type SummaryRow struct {
+	Tag      *string `json:"tag,omitempty"`
+	Period   string  `json:"period,omitempty"`
+	Currency string  `json:"currency"`
+	Count    int     `json:"count"`
+	Total    Money   `json:"total"`
+	Average  Money   `json:"average"`
+	Min      Money   `json:"min"`
+	Max      Money   `json:"max"`
+}
+
+type Summary struct {
+	GroupBy []string     `json:"group_by"`
+	Data    []SummaryRow `json:"data"`
+}
+
+// parseGroupBy reads "tag", a period or "tag,<period>". Without group_by
+// totals are per month.
+func parseGroupBy(v string) (ReportQuery, error) {
+	q := ReportQuery{}
+	if v == "" {
+		v = PeriodMonth
+	}
+	for _, g := range strings.Split(v, ",") {
+		switch g = strings.TrimSpace(g); g {
+		case GroupByTag:
+			if q.Tag {
+				return q, fmt.Errorf("duplicate group_by %q", g)
+			}
+			q.Tag = true
+		case PeriodDay, PeriodWeek, PeriodMonth, PeriodYear:
+			if q.Period != "" {
+				return q, fmt.Errorf("group_by takes one of day, week, month or year")
+			}
+			q.Period = g
+		default:
+			return q, fmt.Errorf("can not group by %q", g)
+		}
+	}
+	return q, nil
+}
+
+func (q ReportQuery) groupBy() []string {
+	var groups []string
+	if q.Tag {
+		groups = append(groups, GroupByTag)
+	}
+	if q.Period != "" {
+		groups = append(groups, q.Period)
+	}
+	return groups
+}
+
+// GetSummaryReportHandler answers GET /reports/summary?group_by=tag,month
+// with the count, total, average, min and max of each group, ordered by
+// group.
+func (h *handler) GetSummaryReportHandler(c echo.Context) error {
+	owner, err := ownerID(c)
+	if err != nil {
+		return err
+	}
+	filter, err := parseListFilter(c)
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+	q, err := parseGroupBy(c.QueryParam("group_by"))
+	if err != nil {
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
+	}
+	filter.OwnerID = owner
+	q.Filter = filter
+
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	rows, err := h.Store.Summarize(ctx, q)
+	if err != nil {
+		return storeError(c, err)
+	}
+	return c.JSON(http.StatusOK, Summary{GroupBy: q.groupBy(), Data: rows})
+}
+
+// summarySQL aggregates in the database. The filters apply to expenses
+// before their tags are unnested; with a tag filter only the filtered tags
+// are reported.
+func (q ReportQuery) summarySQL(d sqlDialect) (string, []interface{}, error) {
+	args := sqlArgs{dialect: d}
+	where, err := q.Filter.where(&args)
+	if err != nil {
+		return "", nil, err
+	}
+
+	from := "(SELECT spent_at, amount, currency, tags FROM expenses WHERE " + where + ") AS e"
+	var keys, conds []string
+	if q.Tag {
+		join, column := d.unnestTags("e.tags")
+		from += " " + join
+		keys = append(keys, "COALESCE("+column+", '')")
+		if len(q.Filter.Tags) > 0 {
+			conds = append(conds, d.tagIn(&args, column, q.Filter.Tags))
+		}
+	}
+	if q.Period != "" {
+		keys = append(keys, d.period(q.Period, "e.spent_at"))
+	}
+	keys = append(keys, "e.currency")
+
+	query := "SELECT " + strings.Join(keys, ", ") + ", COUNT(*), SUM(e.amount), MIN(e.amount), MAX(e.amount) FROM " + from
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	ordinals := make([]string, len(keys))
+	for i := range keys {
+		ordinals[i] = strconv.Itoa(i + 1)
+	}
+	query += " GROUP BY " + strings.Join(ordinals, ", ") + " ORDER BY " + strings.Join(ordinals, ", ")
+	return query, args.values, nil
+}
+
+// scanSummary reads the rows of summarySQL; money wraps amounts for the
+// driver.
+func scanSummary(rows *sql.Rows, q ReportQuery, d sqlDialect) ([]SummaryRow, error) {
+	defer rows.Close()
+
+	summary := []SummaryRow{}
+	for rows.Next() {
+		var r SummaryRow
+		var tag string
+		var dest []interface{}
+		if q.Tag {
+			dest = append(dest, &tag)
+		}
+		if q.Period != "" {
+			dest = append(dest, &r.Period)
+		}
+		dest = append(dest, &r.Currency, &r.Count, d.scan(&r.Total), d.scan(&r.Min), d.scan(&r.Max))
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		if q.Tag {
+			r.Tag = &tag
+		}
+		r.Average = r.Total.divRound(r.Count)
+		summary = append(summary, r)
+	}
+	return summary, rows.Err()
+}
+
+// divRound divides m by n, rounding half away from zero.
+func (m Money) divRound(n int) Money {
+	if n == 0 {
+		return 0
+	}
+	d := Money(n)
+	q, r := m/d, m%d
+	if r < 0 {
+		r = -r
+	}
+	if 2*r >= d {
+		if m < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return q
+}
+
+// periodStart is period of sqlDialect for the memory store.
+func periodStart(unit string, t time.Time) string {
+	start, _ := periodRange(unit, t)
+	return start.Format(dateLayout)
+}
+
+// periodRange returns the UTC period containing t, with an exclusive end.
+// Weeks start on Monday.
+func periodRange(unit string, t time.Time) (time.Time, time.Time) {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch unit {
+	case PeriodWeek:
+		day = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		return day, day.AddDate(0, 0, 7)
+	case PeriodMonth:
+		day = day.AddDate(0, 0, 1-day.Day())
+		return day, day.AddDate(0, 1, 0)
+	case PeriodYear:
+		day = time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+		return day, day.AddDate(1, 0, 0)
+	}
+	return day, day.AddDate(0, 0, 1)
+}
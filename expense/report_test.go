@@ -0,0 +1,76 @@
+//go:build unit
+// +build unit
+
+package expense
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummaryReport(t *testing.T) {
+	t.Run("postgres aggregates with group by", func(t *testing.T) {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mock.ExpectQuery("SELECT COALESCE(t.tag, ''), to_char(date_trunc('month', e.spent_at AT TIME ZONE 'UTC'), 'YYYY-MM-DD'), e.currency, COUNT(*), SUM(e.amount), MIN(e.amount), MAX(e.amount) "+
+			"FROM (SELECT spent_at, amount, currency, tags FROM expenses WHERE owner_id = $1 AND deleted_at IS NULL AND tags && $2 AND spent_at >= $3) AS e "+
+			"LEFT JOIN LATERAL unnest(e.tags) AS t(tag) ON true WHERE t.tag = ANY($4) GROUP BY 1, 2, 3 ORDER BY 1, 2, 3").
+			WithArgs("alice", pq.Array([]string{"food"}), time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), pq.Array([]string{"food"})).
+			WillReturnRows(sqlmock.NewRows([]string{"tag", "period", "currency", "count", "sum", "min", "max"}).
+				AddRow("food", "2023-01-01", "THB", 3, "100.00", "10.00", "60.00"))
+		h := NewHandler(NewPostgresStore(db))
+
+		rec := storeRequest(t, h, http.MethodGet, "/reports/summary?group_by=tag,month&tag=food&spent_from=2023-01-01", "", (*handler).GetSummaryReportHandler)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `{"group_by":["tag","month"],"data":[{"tag":"food","period":"2023-01-01","currency":"THB","count":3,"total":100,"average":33.33,"min":10,"max":60}]}`, strings.TrimSpace(rec.Body.String()))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid groupings are rejected", func(t *testing.T) {
+		for query, message := range map[string]string{
+			"group_by=category":  `can not group by \"category\"`,
+			"group_by=day,month": "group_by takes one of day, week, month or year",
+			"group_by=tag,tag":   `duplicate group_by \"tag\"`,
+			"spent_from=jan":     "spent_from must be a date",
+		} {
+			req := httptest.NewRequest(http.MethodGet, "/reports/summary?"+query, nil)
+			rec := httptest.NewRecorder()
+			c := withOwner(echo.New().NewContext(req, rec))
+
+			assert.NoError(t, NewHandler(NewMemoryStore()).GetSummaryReportHandler(c))
+			assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+			assert.Contains(t, rec.Body.String(), message, query)
+		}
+	})
+
+	t.Run("averages round half away from zero", func(t *testing.T) {
+		assert.Equal(t, Money(3333), Money(10000).divRound(3))
+		assert.Equal(t, Money(6667), Money(20000).divRound(3))
+		assert.Equal(t, Money(-6667), Money(-20000).divRound(3))
+		assert.Equal(t, Money(3), Money(5).divRound(2))
+		assert.Equal(t, Money(0), Money(5).divRound(0))
+	})
+
+	t.Run("periods start on the first day in UTC", func(t *testing.T) {
+		at := time.Date(2023, 1, 1, 3, 0, 0, 0, time.FixedZone("ICT", 7*60*60))
+		assert.Equal(t, "2022-12-31", periodStart(PeriodDay, at))
+		assert.Equal(t, "2022-12-26", periodStart(PeriodWeek, at))
+		assert.Equal(t, "2022-12-01", periodStart(PeriodMonth, at))
+		assert.Equal(t, "2022-01-01", periodStart(PeriodYear, at))
+
+		_, end := periodRange(PeriodWeek, at)
+		assert.Equal(t, "2023-01-02", end.Format(dateLayout))
+		_, end = periodRange(PeriodMonth, at)
+		assert.Equal(t, "2023-01-01", end.Format(dateLayout))
+	})
+}
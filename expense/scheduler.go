@@ -0,0 +1,84 @@
+package expense
+
+import (
+	"context"
+	"golang.org/x/exp/slog"
+	"time"
+)
+
+// Scheduler creates the expenses of recurring templates as they fall due.
+// Runs are claimed in the store, which also remembers the last run of each
+// template, so restarts and several servers sharing a database neither skip
+// nor repeat a run.
+type Scheduler struct {
+	Store    RecurringStore
+	Interval time.Duration
+	Logger   *slog.Logger
+	// MaxRuns is the most runs of one template a call to RunDue creates;
+	// a template further behind catches up over the next calls.
+	MaxRuns int
+
+	now func() time.Time
+}
+
+// DefaultMaxRecurringRuns bounds how many missed runs of a template are
+// created at once, so a starts_at far in the past does not hold up a tick.
+const DefaultMaxRecurringRuns = 50
+
+func NewScheduler(store RecurringStore, interval time.Duration, logger *slog.Logger) *Scheduler {
+	return &Scheduler{Store: store, Interval: interval, Logger: logger, MaxRuns: DefaultMaxRecurringRuns, now: time.Now}
+}
+
+// Run catches up on the runs missed while the server was down, then checks
+// every Interval until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.RunDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDue creates the expenses due now, at most MaxRuns per template, and
+// returns how many it created. A template that fails is logged and retried
+// on the next call.
+func (s *Scheduler) RunDue(ctx context.Context) int {
+	now := s.now()
+	ids, err := s.Store.DueRecurring(ctx, now)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.Logger.Error("recurring expenses not checked", "error", err)
+		}
+		return 0
+	}
+
+	created := 0
+	for _, id := range ids {
+		for runs := 0; ctx.Err() == nil; runs++ {
+			if s.MaxRuns > 0 && runs == s.MaxRuns {
+				s.Logger.Warn("recurring expense behind, catching up on the next run", "recurring_id", id)
+				break
+			}
+			ex, ok, err := s.Store.RunRecurring(ctx, id, now)
+			if err != nil {
+				if ctx.Err() == nil {
+					s.Logger.Error("recurring expense not created", "recurring_id", id, "error", err)
+				}
+				break
+			}
+			if !ok {
+				break
+			}
+			countCreated(ex)
+			created++
+			s.Logger.Info("recurring expense created", "recurring_id", id, "expense_id", ex.ID, "spent_at", ex.SpentAt)
+		}
+	}
+	return created
+}
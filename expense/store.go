@@ -0,0 +1,116 @@
+package expense
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"time"
+)
+
+// ErrNotFound is wrapped by stores when a record does not exist or belongs
+// to another owner.
+var ErrNotFound = errors.New("not found")
+
+var (
+	errExpenseNotFound   = notFound("expense")
+	errRateNotFound      = notFound("exchange rate")
+	errAPIKeyNotFound    = notFound("api key")
+	errBudgetNotFound    = notFound("budget")
+	errRecurringNotFound = notFound("recurring expense")
+)
+
+type notFound string
+
+func (e notFound) Error() string        { return string(e) + " not found" }
+func (e notFound) Is(target error) bool { return target == ErrNotFound }
+
+// ExpenseStore persists expenses. Every method is scoped to an owner and
+// only sees expenses that are not soft deleted, except Restore and Trash.
+type ExpenseStore interface {
+	Create(ctx context.Context, owner string, ex Expense) (Expense, error)
+	// Import creates every expense for owner, or none of them on error.
+	Import(ctx context.Context, owner string, expenses []Expense) ([]Expense, error)
+	Get(ctx context.Context, owner string, id int) (Expense, error)
+	// List returns at most q.Limit expenses of q.OwnerID matching q, in
+	// q.Sort order and starting after q.After.
+	List(ctx context.Context, q ListQuery) ([]Expense, error)
+	// Export passes fn every expense List would return for q, without a
+	// limit, one at a time as they are read. An error from fn stops it.
+	Export(ctx context.Context, q ListQuery, fn func(Expense) error) error
+	Update(ctx context.Context, owner string, ex Expense) (Expense, error)
+	// Patch atomically reads an expense, passes it to apply and stores the
+	// result. Errors from apply are returned unchanged.
+	Patch(ctx context.Context, owner string, id int, apply func(Expense) (Expense, error)) (Expense, error)
+	Delete(ctx context.Context, owner string, id int) error
+	Restore(ctx context.Context, owner string, id int) (Expense, error)
+	Trash(ctx context.Context, owner string) ([]Expense, error)
+	// Summarize returns the aggregates of q, ordered by group.
+	Summarize(ctx context.Context, q ReportQuery) ([]SummaryRow, error)
+}
+
+type RateStore interface {
+	// UpsertRates stores all rates or none, replacing rates for the same
+	// pair and effective date.
+	UpsertRates(ctx context.Context, rates []ExchangeRate) ([]ExchangeRate, error)
+	ListRates(ctx context.Context, base, quote string) ([]ExchangeRate, error)
+	DeleteRate(ctx context.Context, id int) error
+	// FindRate returns the base/quote rate effective on the given day,
+	// or errNoRate.
+	FindRate(ctx context.Context, base, quote string, on time.Time) (ExchangeRate, error)
+}
+
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, owner, name, keyHash string) (APIKey, error)
+	ListAPIKeys(ctx context.Context, owner string) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, owner string, id int) error
+	// APIKeyOwner resolves the hash of an active key to its owner.
+	APIKeyOwner(ctx context.Context, keyHash string) (string, error)
+}
+
+// BudgetStore persists budgets. Every method is scoped to an owner.
+type BudgetStore interface {
+	CreateBudget(ctx context.Context, owner string, b Budget) (Budget, error)
+	GetBudget(ctx context.Context, owner string, id int) (Budget, error)
+	ListBudgets(ctx context.Context, owner string) ([]Budget, error)
+	UpdateBudget(ctx context.Context, owner string, b Budget) (Budget, error)
+	DeleteBudget(ctx context.Context, owner string, id int) error
+}
+
+// RecurringStore persists recurring expense templates. Every method but
+// DueRecurring and RunRecurring is scoped to an owner.
+type RecurringStore interface {
+	CreateRecurring(ctx context.Context, owner string, r Recurring) (Recurring, error)
+	GetRecurring(ctx context.Context, owner string, id int) (Recurring, error)
+	ListRecurring(ctx context.Context, owner string) ([]Recurring, error)
+	// UpdateRecurring replaces the template and reschedules it after its
+	// last run.
+	UpdateRecurring(ctx context.Context, owner string, r Recurring) (Recurring, error)
+	DeleteRecurring(ctx context.Context, owner string, id int) error
+	// DueRecurring returns the ids of the templates with a run due at now.
+	DueRecurring(ctx context.Context, now time.Time) ([]int, error)
+	// RunRecurring atomically creates the expense of the next run of
+	// template id and advances its schedule. It returns false if no run is
+	// due at now, for example because another scheduler has just created it.
+	RunRecurring(ctx context.Context, id int, now time.Time) (Expense, bool, error)
+}
+
+type Store interface {
+	ExpenseStore
+	RateStore
+	APIKeyStore
+	BudgetStore
+	RecurringStore
+	// Ready reports why the store can not serve requests, if it can not.
+	Ready(ctx context.Context) error
+	// Close releases the store once the server has stopped.
+	Close() error
+}
+
+// rateFor turns a stored rate, which may be quoted the other way round, into
+// the multiplier from one currency to another.
+func rateFor(from string, rate ExchangeRate) *big.Rat {
+	if rate.Base == from {
+		return rate.Rate.Rat()
+	}
+	return new(big.Rat).Inv(rate.Rate.Rat())
+}
@@ -0,0 +1,847 @@
+package expense
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore implements Store in process memory. When it has a snapshot
+// path, the data is loaded from that JSON file on open and written back on
+// Close.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	path      string
+	expenses  map[int]*memoryExpense
+	rates     map[int]*ExchangeRate
+	keys      map[int]*memoryAPIKey
+	budgets   map[int]*memoryBudget
+	recurring map[int]*memoryRecurring
+	nextID    struct{ expense, rate, key, budget, recurring int }
+}
+
+type memoryExpense struct {
+	Owner string `json:"owner"`
+	Expense
+}
+
+type memoryAPIKey struct {
+	Owner   string `json:"owner"`
+	KeyHash string `json:"key_hash"`
+	APIKey
+}
+
+type memoryBudget struct {
+	Owner string `json:"owner"`
+	Budget
+}
+
+type memoryRecurring struct {
+	Owner string `json:"owner"`
+	Recurring
+}
+
+type memorySnapshot struct {
+	Expenses  []*memoryExpense   `json:"expenses"`
+	Rates     []*ExchangeRate    `json:"rates"`
+	APIKeys   []*memoryAPIKey    `json:"api_keys"`
+	Budgets   []*memoryBudget    `json:"budgets"`
+	Recurring []*memoryRecurring `json:"recurring"`
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		expenses:  map[int]*memoryExpense{},
+		rates:     map[int]*ExchangeRate{},
+		keys:      map[int]*memoryAPIKey{},
+		budgets:   map[int]*memoryBudget{},
+		recurring: map[int]*memoryRecurring{},
+	}
+}
+
+// OpenMemoryStore returns a store backed by the snapshot at path. A missing
+// file starts an empty store.
+func OpenMemoryStore(path string) (*MemoryStore, error) {
+	s := NewMemoryStore()
+	s.path = path
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snap memorySnapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return nil, fmt.Errorf("read snapshot %s: %w", path, err)
+	}
+	for _, ex := range snap.Expenses {
+		s.expenses[ex.ID] = ex
+		s.nextID.expense = maxInt(s.nextID.expense, ex.ID)
+	}
+	for _, r := range snap.Rates {
+		s.rates[r.ID] = r
+		s.nextID.rate = maxInt(s.nextID.rate, r.ID)
+	}
+	for _, k := range snap.APIKeys {
+		s.keys[k.ID] = k
+		s.nextID.key = maxInt(s.nextID.key, k.ID)
+	}
+	for _, b := range snap.Budgets {
+		s.budgets[b.ID] = b
+		s.nextID.budget = maxInt(s.nextID.budget, b.ID)
+	}
+	for _, r := range snap.Recurring {
+		s.recurring[r.ID] = r
+		s.nextID.recurring = maxInt(s.nextID.recurring, r.ID)
+	}
+	return s, nil
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Ready always succeeds; there is nothing to reach.
+func (s *MemoryStore) Ready(ctx context.Context) error {
+	return nil
+}
+
+// Close writes the snapshot, if the store has one.
+func (s *MemoryStore) Close() error {
+	if s.path == "" {
+		return nil
+	}
+
+	s.mu.RLock()
+	snap := memorySnapshot{Expenses: []*memoryExpense{}, Rates: []*ExchangeRate{}, APIKeys: []*memoryAPIKey{}, Budgets: []*memoryBudget{}, Recurring: []*memoryRecurring{}}
+	for _, ex := range s.expenses {
+		snap.Expenses = append(snap.Expenses, ex)
+	}
+	for _, r := range s.rates {
+		snap.Rates = append(snap.Rates, r)
+	}
+	for _, k := range s.keys {
+		snap.APIKeys = append(snap.APIKeys, k)
+	}
+	for _, b := range s.budgets {
+		snap.Budgets = append(snap.Budgets, b)
+	}
+	for _, r := range s.recurring {
+		snap.Recurring = append(snap.Recurring, r)
+	}
+	b, err := json.MarshalIndent(snap, "", "  ")
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	// Write next to the snapshot and rename so a crash never leaves it
+	// half written.
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// copyExpense keeps callers from sharing the tags of a stored expense.
+func copyExpense(ex Expense) Expense {
+	if ex.Tags != nil {
+		ex.Tags = append([]string{}, ex.Tags...)
+	}
+	return ex
+}
+
+func (s *MemoryStore) Create(ctx context.Context, owner string, ex Expense) (Expense, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.create(owner, ex), nil
+}
+
+func (s *MemoryStore) Import(ctx context.Context, owner string, expenses []Expense) ([]Expense, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	created := make([]Expense, len(expenses))
+	for i, ex := range expenses {
+		created[i] = s.create(owner, ex)
+	}
+	return created, nil
+}
+
+// create adds ex for owner; the caller holds the write lock.
+func (s *MemoryStore) create(owner string, ex Expense) Expense {
+	now := time.Now()
+	s.nextID.expense++
+	ex = copyExpense(ex)
+	ex.ID = s.nextID.expense
+	if ex.SpentAt == nil {
+		ex.SpentAt = &now
+	}
+	ex.CreatedAt, ex.UpdatedAt, ex.DeletedAt = &now, &now, nil
+	s.expenses[ex.ID] = &memoryExpense{Owner: owner, Expense: ex}
+	return copyExpense(ex)
+}
+
+// live returns the expense with id if it belongs to owner and is not deleted.
+func (s *MemoryStore) live(owner string, id int) (*memoryExpense, bool) {
+	ex, ok := s.expenses[id]
+	if !ok || ex.Owner != owner || ex.DeletedAt != nil {
+		return nil, false
+	}
+	return ex, true
+}
+
+func (s *MemoryStore) Get(ctx context.Context, owner string, id int) (Expense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ex, ok := s.live(owner, id)
+	if !ok {
+		return Expense{}, errExpenseNotFound
+	}
+	return copyExpense(ex.Expense), nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, q ListQuery) ([]Expense, error) {
+	var after []interface{}
+	if q.After != nil {
+		var err error
+		if after, err = q.afterValues(); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.RLock()
+	expenses := []Expense{}
+	for _, ex := range s.expenses {
+		if ex.Owner != q.OwnerID || ex.DeletedAt != nil || !q.matches(ex.Expense) {
+			continue
+		}
+		if after != nil && q.compare(memorySortValues(q.Sort, ex.Expense), after) <= 0 {
+			continue
+		}
+		expenses = append(expenses, copyExpense(ex.Expense))
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(expenses, func(i, j int) bool {
+		return q.compare(memorySortValues(q.Sort, expenses[i]), memorySortValues(q.Sort, expenses[j])) < 0
+	})
+	if q.Limit > 0 && len(expenses) > q.Limit {
+		expenses = expenses[:q.Limit]
+	}
+	return expenses, nil
+}
+
+func (s *MemoryStore) Export(ctx context.Context, q ListQuery, fn func(Expense) error) error {
+	q.Limit, q.After = 0, nil
+	expenses, err := s.List(ctx, q)
+	if err != nil {
+		return err
+	}
+	for _, ex := range expenses {
+		if err := fn(ex); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matches evaluates the filters of q the same way where does in SQL.
+func (q ListQuery) matches(ex Expense) bool {
+	if len(q.Tags) > 0 {
+		found := 0
+		for _, tag := range q.Tags {
+			if containsString(ex.Tags, tag) {
+				found++
+			}
+		}
+		if found == 0 || (q.TagMatch == TagMatchAll && found < len(q.Tags)) {
+			return false
+		}
+	}
+	if q.MinAmount != nil && ex.Amount < *q.MinAmount {
+		return false
+	}
+	if q.MaxAmount != nil && ex.Amount > *q.MaxAmount {
+		return false
+	}
+	if q.Title != "" && !strings.Contains(strings.ToLower(ex.Title), strings.ToLower(q.Title)) {
+		return false
+	}
+	if q.Note != "" && !strings.Contains(strings.ToLower(ex.Note), strings.ToLower(q.Note)) {
+		return false
+	}
+	if !inRange(ex.SpentAt, q.SpentFrom, q.SpentTo) || !inRange(ex.CreatedAt, q.CreatedFrom, q.CreatedTo) {
+		return false
+	}
+	if len(q.IDs) > 0 {
+		found := false
+		for _, id := range q.IDs {
+			found = found || id == ex.ID
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func inRange(t, from, to *time.Time) bool {
+	if from == nil && to == nil {
+		return true
+	}
+	if t == nil {
+		return false
+	}
+	return (from == nil || !t.Before(*from)) && (to == nil || t.Before(*to))
+}
+
+// memorySortValues returns the values of ex for each sort field, typed like
+// the values decoded from a cursor.
+func memorySortValues(fields []SortField, ex Expense) []interface{} {
+	deref := func(t *time.Time) time.Time {
+		if t == nil {
+			return time.Time{}
+		}
+		return *t
+	}
+
+	values := make([]interface{}, len(fields))
+	for i, f := range fields {
+		switch f.Field {
+		case "id":
+			values[i] = ex.ID
+		case "title":
+			values[i] = ex.Title
+		case "note":
+			values[i] = ex.Note
+		case "amount":
+			values[i] = ex.Amount
+		case "spent_at":
+			values[i] = deref(ex.SpentAt)
+		case "created_at":
+			values[i] = deref(ex.CreatedAt)
+		case "updated_at":
+			values[i] = deref(ex.UpdatedAt)
+		}
+	}
+	return values
+}
+
+// compare orders two value lists by the sort fields of q.
+func (q ListQuery) compare(a, b []interface{}) int {
+	for i, f := range q.Sort {
+		c := compareValues(a[i], b[i])
+		if f.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case int:
+		return compareOrdered(a, b.(int))
+	case Money:
+		return compareOrdered(a, b.(Money))
+	case string:
+		return strings.Compare(a, b.(string))
+	case time.Time:
+		return compareOrdered(a.UnixNano(), b.(time.Time).UnixNano())
+	}
+	return 0
+}
+
+func compareOrdered[T int | int64 | Money](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (s *MemoryStore) Update(ctx context.Context, owner string, ex Expense) (Expense, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.live(owner, ex.ID)
+	if !ok {
+		return ex, errExpenseNotFound
+	}
+	s.store(stored, ex)
+	return copyExpense(stored.Expense), nil
+}
+
+// store copies the editable fields of ex onto stored, keeping spent_at when
+// ex has none, like the SQL update does.
+func (s *MemoryStore) store(stored *memoryExpense, ex Expense) {
+	now := time.Now()
+	stored.Title = ex.Title
+	stored.Amount = ex.Amount
+	stored.Currency = ex.Currency
+	stored.Note = ex.Note
+	stored.Tags = copyExpense(ex).Tags
+	if ex.SpentAt != nil {
+		stored.SpentAt = ex.SpentAt
+	}
+	stored.UpdatedAt = &now
+}
+
+func (s *MemoryStore) Patch(ctx context.Context, owner string, id int, apply func(Expense) (Expense, error)) (Expense, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.live(owner, id)
+	if !ok {
+		return Expense{}, errExpenseNotFound
+	}
+	patched, err := apply(copyExpense(stored.Expense))
+	if err != nil {
+		return patched, err
+	}
+	s.store(stored, patched)
+	return copyExpense(stored.Expense), nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, owner string, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.live(owner, id)
+	if !ok {
+		return errExpenseNotFound
+	}
+	now := time.Now()
+	stored.DeletedAt = &now
+	return nil
+}
+
+func (s *MemoryStore) Restore(ctx context.Context, owner string, id int) (Expense, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.expenses[id]
+	if !ok || stored.Owner != owner || stored.DeletedAt == nil {
+		return Expense{}, notFound("deleted expense")
+	}
+	now := time.Now()
+	stored.DeletedAt = nil
+	stored.UpdatedAt = &now
+	return copyExpense(stored.Expense), nil
+}
+
+func (s *MemoryStore) Trash(ctx context.Context, owner string) ([]Expense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	expenses := []Expense{}
+	for _, ex := range s.expenses {
+		if ex.Owner == owner && ex.DeletedAt != nil {
+			expenses = append(expenses, copyExpense(ex.Expense))
+		}
+	}
+	sort.Slice(expenses, func(i, j int) bool {
+		return expenses[i].DeletedAt.After(*expenses[j].DeletedAt)
+	})
+	return expenses, nil
+}
+
+func (s *MemoryStore) Summarize(ctx context.Context, q ReportQuery) ([]SummaryRow, error) {
+	type key struct{ tag, period, currency string }
+	groups := map[key]*SummaryRow{}
+	add := func(k key, amount Money) error {
+		r, ok := groups[k]
+		if !ok {
+			r = &SummaryRow{Period: k.period, Currency: k.currency, Min: amount, Max: amount}
+			if q.Tag {
+				tag := k.tag
+				r.Tag = &tag
+			}
+			groups[k] = r
+		}
+		total, err := r.Total.Add(amount)
+		if err != nil {
+			return err
+		}
+		r.Total = total
+		r.Count++
+		if amount < r.Min {
+			r.Min = amount
+		}
+		if amount > r.Max {
+			r.Max = amount
+		}
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, ex := range s.expenses {
+		if ex.Owner != q.Filter.OwnerID || ex.DeletedAt != nil || !q.Filter.matches(ex.Expense) {
+			continue
+		}
+		k := key{currency: ex.Currency}
+		if q.Period != "" && ex.SpentAt != nil {
+			k.period = periodStart(q.Period, *ex.SpentAt)
+		}
+		if !q.Tag {
+			if err := add(k, ex.Amount); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		tags := ex.Tags
+		if len(tags) == 0 {
+			tags = []string{""}
+		}
+		for _, tag := range tags {
+			if len(q.Filter.Tags) > 0 && !containsString(q.Filter.Tags, tag) {
+				continue
+			}
+			k.tag = tag
+			if err := add(k, ex.Amount); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	summary := make([]SummaryRow, 0, len(groups))
+	for _, r := range groups {
+		r.Average = r.Total.divRound(r.Count)
+		summary = append(summary, *r)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		a, b := summary[i], summary[j]
+		if a.Tag != nil && *a.Tag != *b.Tag {
+			return *a.Tag < *b.Tag
+		}
+		if a.Period != b.Period {
+			return a.Period < b.Period
+		}
+		return a.Currency < b.Currency
+	})
+	return summary, nil
+}
+
+func (s *MemoryStore) UpsertRates(ctx context.Context, rates []ExchangeRate) ([]ExchangeRate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range rates {
+		r := &rates[i]
+		r.ID = 0
+		for _, stored := range s.rates {
+			if stored.Base == r.Base && stored.Quote == r.Quote && stored.EffectiveDate == r.EffectiveDate {
+				r.ID = stored.ID
+			}
+		}
+		if r.ID == 0 {
+			s.nextID.rate++
+			r.ID = s.nextID.rate
+		}
+		stored := *r
+		s.rates[r.ID] = &stored
+	}
+	return rates, nil
+}
+
+func (s *MemoryStore) ListRates(ctx context.Context, base, quote string) ([]ExchangeRate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rates := []ExchangeRate{}
+	for _, r := range s.rates {
+		if (base == "" || r.Base == base) && (quote == "" || r.Quote == quote) {
+			rates = append(rates, *r)
+		}
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		a, b := rates[i], rates[j]
+		if a.Base != b.Base {
+			return a.Base < b.Base
+		}
+		if a.Quote != b.Quote {
+			return a.Quote < b.Quote
+		}
+		return a.EffectiveDate > b.EffectiveDate
+	})
+	return rates, nil
+}
+
+func (s *MemoryStore) DeleteRate(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rates[id]; !ok {
+		return errRateNotFound
+	}
+	delete(s.rates, id)
+	return nil
+}
+
+func (s *MemoryStore) FindRate(ctx context.Context, base, quote string, on time.Time) (ExchangeRate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	day := on.Format(dateLayout)
+	var found *ExchangeRate
+	for _, r := range s.rates {
+		direct := r.Base == base && r.Quote == quote
+		if !direct && !(r.Base == quote && r.Quote == base) || r.EffectiveDate > day {
+			continue
+		}
+		if found == nil || r.EffectiveDate > found.EffectiveDate || (r.EffectiveDate == found.EffectiveDate && direct) {
+			found = r
+		}
+	}
+	if found == nil {
+		return ExchangeRate{}, fmt.Errorf("%w from %s to %s on %s", errNoRate, base, quote, day)
+	}
+	return *found, nil
+}
+
+func (s *MemoryStore) CreateAPIKey(ctx context.Context, owner, name, keyHash string) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID.key++
+	k := &memoryAPIKey{
+		Owner:   owner,
+		KeyHash: keyHash,
+		APIKey:  APIKey{ID: s.nextID.key, Name: name, CreatedAt: time.Now()},
+	}
+	s.keys[k.ID] = k
+	return k.APIKey, nil
+}
+
+func (s *MemoryStore) ListAPIKeys(ctx context.Context, owner string) ([]APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := []APIKey{}
+	for _, k := range s.keys {
+		if k.Owner == owner {
+			keys = append(keys, k.APIKey)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+func (s *MemoryStore) RevokeAPIKey(ctx context.Context, owner string, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[id]
+	if !ok || k.Owner != owner || k.RevokedAt != nil {
+		return errAPIKeyNotFound
+	}
+	now := time.Now()
+	k.RevokedAt = &now
+	return nil
+}
+
+func (s *MemoryStore) APIKeyOwner(ctx context.Context, keyHash string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, k := range s.keys {
+		if k.KeyHash == keyHash && k.RevokedAt == nil {
+			return k.Owner, nil
+		}
+	}
+	return "", errAPIKeyNotFound
+}
+
+func (s *MemoryStore) CreateBudget(ctx context.Context, owner string, b Budget) (Budget, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID.budget++
+	b.ID = s.nextID.budget
+	s.budgets[b.ID] = &memoryBudget{Owner: owner, Budget: b}
+	return b, nil
+}
+
+func (s *MemoryStore) GetBudget(ctx context.Context, owner string, id int) (Budget, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	b, ok := s.budgets[id]
+	if !ok || b.Owner != owner {
+		return Budget{}, errBudgetNotFound
+	}
+	return b.Budget, nil
+}
+
+func (s *MemoryStore) ListBudgets(ctx context.Context, owner string) ([]Budget, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	budgets := []Budget{}
+	for _, b := range s.budgets {
+		if b.Owner == owner {
+			budgets = append(budgets, b.Budget)
+		}
+	}
+	sort.Slice(budgets, func(i, j int) bool { return budgets[i].ID < budgets[j].ID })
+	return budgets, nil
+}
+
+func (s *MemoryStore) UpdateBudget(ctx context.Context, owner string, b Budget) (Budget, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.budgets[b.ID]
+	if !ok || stored.Owner != owner {
+		return Budget{}, errBudgetNotFound
+	}
+	stored.Budget = b
+	return b, nil
+}
+
+func (s *MemoryStore) DeleteBudget(ctx context.Context, owner string, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.budgets[id]
+	if !ok || b.Owner != owner {
+		return errBudgetNotFound
+	}
+	delete(s.budgets, id)
+	return nil
+}
+
+// copyRecurring keeps callers from sharing the tags of a stored template.
+func copyRecurring(r Recurring) Recurring {
+	r.Tags = append([]string{}, r.Tags...)
+	return r
+}
+
+func (s *MemoryStore) CreateRecurring(ctx context.Context, owner string, r Recurring) (Recurring, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID.recurring++
+	r = copyRecurring(r)
+	r.ID = s.nextID.recurring
+	s.recurring[r.ID] = &memoryRecurring{Owner: owner, Recurring: r}
+	return copyRecurring(r), nil
+}
+
+func (s *MemoryStore) GetRecurring(ctx context.Context, owner string, id int) (Recurring, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	r, ok := s.recurring[id]
+	if !ok || r.Owner != owner {
+		return Recurring{}, errRecurringNotFound
+	}
+	return copyRecurring(r.Recurring), nil
+}
+
+func (s *MemoryStore) ListRecurring(ctx context.Context, owner string) ([]Recurring, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []Recurring{}
+	for _, r := range s.recurring {
+		if r.Owner == owner {
+			list = append(list, copyRecurring(r.Recurring))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (s *MemoryStore) UpdateRecurring(ctx context.Context, owner string, r Recurring) (Recurring, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.recurring[r.ID]
+	if !ok || stored.Owner != owner {
+		return Recurring{}, errRecurringNotFound
+	}
+	r = copyRecurring(r)
+	r.LastRun = stored.LastRun
+	r.reschedule()
+	stored.Recurring = r
+	return copyRecurring(r), nil
+}
+
+func (s *MemoryStore) DeleteRecurring(ctx context.Context, owner string, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.recurring[id]
+	if !ok || r.Owner != owner {
+		return errRecurringNotFound
+	}
+	delete(s.recurring, id)
+	return nil
+}
+
+func (s *MemoryStore) DueRecurring(ctx context.Context, now time.Time) ([]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := []int{}
+	for id, r := range s.recurring {
+		if r.NextRun != nil && !r.NextRun.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (s *MemoryStore) RunRecurring(ctx context.Context, id int, now time.Time) (Expense, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.recurring[id]
+	if !ok || r.NextRun == nil || r.NextRun.After(now) {
+		return Expense{}, false, nil
+	}
+	ex := s.create(r.Owner, r.expense(*r.NextRun))
+	r.LastRun = r.NextRun
+	r.reschedule()
+	return ex, true, nil
+}
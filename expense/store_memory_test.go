@@ -0,0 +1,44 @@
+//go:build unit
+// +build unit
+
+package expense
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+
+	testStore(t, func(t *testing.T) Store { return NewMemoryStore() })
+
+	t.Run("snapshot is saved on close and loaded on open", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "expenses.json")
+		store, err := OpenMemoryStore(path)
+		assert.NoError(t, err)
+		ex, err := store.Create(ctx, "alice", Expense{Title: "coffee", Amount: 6000, Currency: "THB", Tags: []string{"beverage"}})
+		assert.NoError(t, err)
+		_, err = store.CreateAPIKey(ctx, "alice", "laptop", hashAPIKey("exp_abc"))
+		assert.NoError(t, err)
+		assert.NoError(t, store.Close())
+
+		store, err = OpenMemoryStore(path)
+		assert.NoError(t, err)
+		loaded, err := store.Get(ctx, "alice", ex.ID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "coffee", loaded.Title)
+			assert.Equal(t, Money(6000), loaded.Amount)
+			assert.Equal(t, []string{"beverage"}, loaded.Tags)
+		}
+		owner, err := store.APIKeyOwner(ctx, hashAPIKey("exp_abc"))
+		assert.NoError(t, err)
+		assert.Equal(t, "alice", owner)
+
+		next, err := store.Create(ctx, "alice", Expense{Title: "tea"})
+		assert.NoError(t, err)
+		assert.Equal(t, ex.ID+1, next.ID)
+	})
+}
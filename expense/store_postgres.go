@@ -0,0 +1,235 @@
+package expense
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"strings"
+	"time"
+)
+
+// PostgresStore implements Store on top of PostgreSQL.
+type PostgresStore struct {
+	sqlStore
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{sqlStore{DB: db, dialect: postgresDialect{}, createExpense: createPostgresExpense}}
+}
+
+func (s *PostgresStore) Ready(ctx context.Context) error {
+	return sqlReady(ctx, s.DB, "postgres")
+}
+
+func (s *PostgresStore) Create(ctx context.Context, owner string, ex Expense) (Expense, error) {
+	return createPostgresExpense(ctx, s.DB, owner, ex)
+}
+
+func (s *PostgresStore) Import(ctx context.Context, owner string, expenses []Expense) ([]Expense, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	created := make([]Expense, len(expenses))
+	for i, ex := range expenses {
+		if created[i], err = createPostgresExpense(ctx, tx, owner, ex); err != nil {
+			return nil, fmt.Errorf("expense %d: %w", i+1, err)
+		}
+	}
+	return created, tx.Commit()
+}
+
+func createPostgresExpense(ctx context.Context, db queryRower, owner string, ex Expense) (Expense, error) {
+	row := db.QueryRowContext(ctx, "INSERT INTO expenses(title, amount, currency, note, tags, spent_at, owner_id) values($1, $2, $3, $4, $5, $6, $7) RETURNING "+expenseColumns, ex.Title, ex.Amount, ex.Currency, ex.Note, pq.Array(ex.Tags), ex.SpentAt, owner)
+	err := scanExpense(postgresDialect{}, row, &ex)
+	return ex, err
+}
+
+func (s *PostgresStore) Export(ctx context.Context, q ListQuery, fn func(Expense) error) error {
+	args := sqlArgs{dialect: postgresDialect{}}
+	where, err := q.where(&args)
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.DB.QueryContext(ctx, "SELECT "+expenseColumns+" FROM expenses WHERE "+where+" ORDER BY "+q.orderBy(), args.values...)
+	if err != nil {
+		return err
+	}
+	return eachExpense(rows, func(rows *sql.Rows, ex *Expense) error {
+		return scanExpense(postgresDialect{}, rows, ex)
+	}, fn)
+}
+
+func (s *PostgresStore) Update(ctx context.Context, owner string, ex Expense) (Expense, error) {
+	stmt, err := s.DB.PrepareContext(ctx, "UPDATE expenses SET title=$2 , amount=$3, currency=$4, note=$5, tags=$6, spent_at=COALESCE($7, spent_at), updated_at=now() WHERE id=$1 AND owner_id=$8 AND deleted_at IS NULL RETURNING "+expenseColumns)
+	if err != nil {
+		return ex, err
+	}
+	defer stmt.Close()
+
+	err = scanExpense(postgresDialect{}, stmt.QueryRowContext(ctx, ex.ID, ex.Title, ex.Amount, ex.Currency, ex.Note, pq.Array(ex.Tags), ex.SpentAt, owner), &ex)
+	if err == sql.ErrNoRows {
+		return ex, errExpenseNotFound
+	}
+	return ex, err
+}
+
+func (s *PostgresStore) Patch(ctx context.Context, owner string, id int, apply func(Expense) (Expense, error)) (Expense, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Expense{}, err
+	}
+	defer tx.Rollback()
+
+	ex := Expense{}
+	row := tx.QueryRowContext(ctx, "SELECT "+expenseColumns+" FROM expenses WHERE id=$1 AND owner_id=$2 AND deleted_at IS NULL FOR UPDATE", id, owner)
+	switch err := scanExpense(postgresDialect{}, row, &ex); err {
+	case nil:
+	case sql.ErrNoRows:
+		return ex, errExpenseNotFound
+	default:
+		return ex, err
+	}
+
+	patched, err := apply(ex)
+	if err != nil {
+		return ex, err
+	}
+
+	row = tx.QueryRowContext(ctx, "UPDATE expenses SET title=$2 , amount=$3, currency=$4, note=$5, tags=$6, spent_at=COALESCE($7, spent_at), updated_at=now() WHERE id=$1 RETURNING "+expenseColumns, id, patched.Title, patched.Amount, patched.Currency, patched.Note, pq.Array(patched.Tags), patched.SpentAt)
+	if err := scanExpense(postgresDialect{}, row, &patched); err != nil {
+		return patched, err
+	}
+	return patched, tx.Commit()
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, owner string, id int) error {
+	res, err := s.DB.ExecContext(ctx, "UPDATE expenses SET deleted_at=now() WHERE id=$1 AND owner_id=$2 AND deleted_at IS NULL", id, owner)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errExpenseNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStore) Restore(ctx context.Context, owner string, id int) (Expense, error) {
+	ex := Expense{}
+	row := s.DB.QueryRowContext(ctx, "UPDATE expenses SET deleted_at=NULL, updated_at=now() WHERE id=$1 AND owner_id=$2 AND deleted_at IS NOT NULL RETURNING "+expenseColumns, id, owner)
+	err := scanExpense(postgresDialect{}, row, &ex)
+	if err == sql.ErrNoRows {
+		return ex, notFound("deleted expense")
+	}
+	return ex, err
+}
+
+const upsertRateSQL = `INSERT INTO exchange_rates(base, quote, rate, effective_date) values($1, $2, $3, $4)
+	ON CONFLICT (base, quote, effective_date) DO UPDATE SET rate=EXCLUDED.rate
+	RETURNING id`
+
+func (s *PostgresStore) UpsertRates(ctx context.Context, rates []ExchangeRate) ([]ExchangeRate, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for i := range rates {
+		r := &rates[i]
+		if err := tx.QueryRowContext(ctx, upsertRateSQL, r.Base, r.Quote, r.Rate, r.EffectiveDate).Scan(&r.ID); err != nil {
+			return nil, err
+		}
+	}
+	return rates, tx.Commit()
+}
+
+func (s *PostgresStore) ListRates(ctx context.Context, base, quote string) ([]ExchangeRate, error) {
+	query := "SELECT id, base, quote, rate, effective_date FROM exchange_rates"
+	args := sqlArgs{dialect: postgresDialect{}}
+	var conds []string
+	if base != "" {
+		conds = append(conds, "base = "+args.add(base))
+	}
+	if quote != "" {
+		conds = append(conds, "quote = "+args.add(quote))
+	}
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	rows, err := s.DB.QueryContext(ctx, query+" ORDER BY base, quote, effective_date DESC", args.values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []ExchangeRate{}
+	for rows.Next() {
+		var rate ExchangeRate
+		var effective time.Time
+		if err := rows.Scan(&rate.ID, &rate.Base, &rate.Quote, &rate.Rate, &effective); err != nil {
+			return nil, err
+		}
+		rate.EffectiveDate = effective.Format(dateLayout)
+		rates = append(rates, rate)
+	}
+	return rates, rows.Err()
+}
+
+func (s *PostgresStore) FindRate(ctx context.Context, base, quote string, on time.Time) (ExchangeRate, error) {
+	rate := ExchangeRate{}
+	var effective time.Time
+	err := s.DB.QueryRowContext(ctx, `SELECT id, base, quote, rate, effective_date FROM exchange_rates
+		WHERE ((base=$1 AND quote=$2) OR (base=$2 AND quote=$1)) AND effective_date <= $3
+		ORDER BY effective_date DESC, base=$1 DESC LIMIT 1`, base, quote, on.Format(dateLayout)).Scan(&rate.ID, &rate.Base, &rate.Quote, &rate.Rate, &effective)
+	if err == sql.ErrNoRows {
+		return rate, fmt.Errorf("%w from %s to %s on %s", errNoRate, base, quote, on.Format(dateLayout))
+	}
+	rate.EffectiveDate = effective.Format(dateLayout)
+	return rate, err
+}
+
+func (s *PostgresStore) CreateAPIKey(ctx context.Context, owner, name, keyHash string) (APIKey, error) {
+	k := APIKey{Name: name}
+	row := s.DB.QueryRowContext(ctx, "INSERT INTO api_keys(owner_id, name, key_hash) values($1, $2, $3) RETURNING id, created_at", owner, name, keyHash)
+	err := row.Scan(&k.ID, &k.CreatedAt)
+	return k, err
+}
+
+func (s *PostgresStore) ListAPIKeys(ctx context.Context, owner string) ([]APIKey, error) {
+	rows, err := s.DB.QueryContext(ctx, "SELECT id, name, created_at, revoked_at FROM api_keys WHERE owner_id=$1 ORDER BY id", owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		if err := rows.Scan(&k.ID, &k.Name, &k.CreatedAt, &k.RevokedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (s *PostgresStore) RevokeAPIKey(ctx context.Context, owner string, id int) error {
+	res, err := s.DB.ExecContext(ctx, "UPDATE api_keys SET revoked_at=now() WHERE id=$1 AND owner_id=$2 AND revoked_at IS NULL", id, owner)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errAPIKeyNotFound
+	}
+	return err
+}
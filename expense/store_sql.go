@@ -0,0 +1,362 @@
+package expense
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// sqlStore holds the queries PostgresStore and SQLiteStore share. They are
+// written with $n placeholders; the dialect renders those and binds and
+// scans the values each database stores differently.
+type sqlStore struct {
+	DB      *sql.DB
+	dialect sqlDialect
+	// createExpense inserts ex, filling in the timestamps the way the
+	// database does.
+	createExpense func(ctx context.Context, db queryRower, owner string, ex Expense) (Expense, error)
+}
+
+const expenseColumns = "id,title, amount, currency, note, tags, spent_at, created_at, updated_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// queryRower is a *sql.DB or a *sql.Tx.
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+var placeholderPattern = regexp.MustCompile(`\$\d+`)
+
+// query renders the $n placeholders of query for the dialect.
+func (s *sqlStore) query(query string) string {
+	return placeholderPattern.ReplaceAllStringFunc(query, func(p string) string {
+		n, _ := strconv.Atoi(p[1:])
+		return s.dialect.placeholder(n)
+	})
+}
+
+// args binds values for the dialect.
+func (s *sqlStore) args(values ...interface{}) []interface{} {
+	for i, v := range values {
+		values[i] = s.dialect.bind(v)
+	}
+	return values
+}
+
+func (s *sqlStore) Close() error {
+	return s.DB.Close()
+}
+
+// scanExpense reads the expenseColumns of row, followed by extra, into ex.
+func scanExpense(d sqlDialect, row rowScanner, ex *Expense, extra ...interface{}) error {
+	dest := []interface{}{&ex.ID, &ex.Title, d.scan(&ex.Amount), &ex.Currency, &ex.Note, d.scan(&ex.Tags),
+		d.scan(&ex.SpentAt), d.scan(&ex.CreatedAt), d.scan(&ex.UpdatedAt)}
+	return row.Scan(append(dest, extra...)...)
+}
+
+func scanExpenses(rows *sql.Rows, scan func(rows *sql.Rows, ex *Expense) error) ([]Expense, error) {
+	defer rows.Close()
+
+	expenses := []Expense{}
+	for rows.Next() {
+		var ex Expense
+		if err := scan(rows, &ex); err != nil {
+			return nil, err
+		}
+		expenses = append(expenses, ex)
+	}
+	return expenses, rows.Err()
+}
+
+// eachExpense passes rows to fn one at a time, so that they need not fit
+// in memory.
+func eachExpense(rows *sql.Rows, scan func(rows *sql.Rows, ex *Expense) error, fn func(Expense) error) error {
+	defer rows.Close()
+
+	for rows.Next() {
+		var ex Expense
+		if err := scan(rows, &ex); err != nil {
+			return err
+		}
+		if err := fn(ex); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *sqlStore) Get(ctx context.Context, owner string, id int) (Expense, error) {
+	ex := Expense{}
+	row := s.DB.QueryRowContext(ctx, s.query("SELECT "+expenseColumns+" FROM expenses WHERE id=$1 AND owner_id=$2 AND deleted_at IS NULL"), id, owner)
+	err := scanExpense(s.dialect, row, &ex)
+	if err == sql.ErrNoRows {
+		return ex, errExpenseNotFound
+	}
+	return ex, err
+}
+
+func (s *sqlStore) List(ctx context.Context, q ListQuery) ([]Expense, error) {
+	args := sqlArgs{dialect: s.dialect}
+	where, err := q.where(&args)
+	if err != nil {
+		return nil, err
+	}
+	limit := args.add(q.Limit)
+
+	rows, err := s.DB.QueryContext(ctx, "SELECT "+expenseColumns+" FROM expenses WHERE "+where+" ORDER BY "+q.orderBy()+" LIMIT "+limit, args.values...)
+	if err != nil {
+		return nil, err
+	}
+	return scanExpenses(rows, func(rows *sql.Rows, ex *Expense) error {
+		return scanExpense(s.dialect, rows, ex)
+	})
+}
+
+func (s *sqlStore) Trash(ctx context.Context, owner string) ([]Expense, error) {
+	rows, err := s.DB.QueryContext(ctx, s.query("SELECT "+expenseColumns+", deleted_at FROM expenses WHERE owner_id=$1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC"), owner)
+	if err != nil {
+		return nil, err
+	}
+	return scanExpenses(rows, func(rows *sql.Rows, ex *Expense) error {
+		return scanExpense(s.dialect, rows, ex, s.dialect.scan(&ex.DeletedAt))
+	})
+}
+
+func (s *sqlStore) Summarize(ctx context.Context, q ReportQuery) ([]SummaryRow, error) {
+	query, args, err := q.summarySQL(s.dialect)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanSummary(rows, q, s.dialect)
+}
+
+func (s *sqlStore) DeleteRate(ctx context.Context, id int) error {
+	res, err := s.DB.ExecContext(ctx, s.query("DELETE FROM exchange_rates WHERE id=$1"), id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errRateNotFound
+	}
+	return err
+}
+
+func (s *sqlStore) APIKeyOwner(ctx context.Context, keyHash string) (string, error) {
+	var owner string
+	err := s.DB.QueryRowContext(ctx, s.query("SELECT owner_id FROM api_keys WHERE key_hash=$1 AND revoked_at IS NULL"), keyHash).Scan(&owner)
+	if err == sql.ErrNoRows {
+		return "", errAPIKeyNotFound
+	}
+	return owner, err
+}
+
+const budgetColumns = "id, tag, amount, currency, period"
+
+func scanBudget(d sqlDialect, row rowScanner, b *Budget) error {
+	return row.Scan(&b.ID, &b.Tag, d.scan(&b.Amount), &b.Currency, &b.Period)
+}
+
+func (s *sqlStore) CreateBudget(ctx context.Context, owner string, b Budget) (Budget, error) {
+	err := s.DB.QueryRowContext(ctx, s.query("INSERT INTO budgets(owner_id, tag, amount, currency, period) values($1, $2, $3, $4, $5) RETURNING id"),
+		s.args(owner, b.Tag, b.Amount, b.Currency, b.Period)...).Scan(&b.ID)
+	return b, err
+}
+
+func (s *sqlStore) GetBudget(ctx context.Context, owner string, id int) (Budget, error) {
+	var b Budget
+	err := scanBudget(s.dialect, s.DB.QueryRowContext(ctx, s.query("SELECT "+budgetColumns+" FROM budgets WHERE id=$1 AND owner_id=$2"), id, owner), &b)
+	if err == sql.ErrNoRows {
+		return b, errBudgetNotFound
+	}
+	return b, err
+}
+
+func (s *sqlStore) ListBudgets(ctx context.Context, owner string) ([]Budget, error) {
+	rows, err := s.DB.QueryContext(ctx, s.query("SELECT "+budgetColumns+" FROM budgets WHERE owner_id=$1 ORDER BY id"), owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	budgets := []Budget{}
+	for rows.Next() {
+		var b Budget
+		if err := scanBudget(s.dialect, rows, &b); err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, b)
+	}
+	return budgets, rows.Err()
+}
+
+func (s *sqlStore) UpdateBudget(ctx context.Context, owner string, b Budget) (Budget, error) {
+	res, err := s.DB.ExecContext(ctx, s.query("UPDATE budgets SET tag=$3, amount=$4, currency=$5, period=$6 WHERE id=$1 AND owner_id=$2"),
+		s.args(b.ID, owner, b.Tag, b.Amount, b.Currency, b.Period)...)
+	if err != nil {
+		return b, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return b, errBudgetNotFound
+	}
+	return b, err
+}
+
+func (s *sqlStore) DeleteBudget(ctx context.Context, owner string, id int) error {
+	res, err := s.DB.ExecContext(ctx, s.query("DELETE FROM budgets WHERE id=$1 AND owner_id=$2"), id, owner)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errBudgetNotFound
+	}
+	return err
+}
+
+const recurringColumns = "id, title, amount, currency, note, tags, frequency, interval_count, day_of_month, starts_at, ends_at, last_run, next_run"
+
+func scanRecurring(d sqlDialect, row rowScanner, r *Recurring, extra ...interface{}) error {
+	var startsAt *time.Time
+	dest := []interface{}{&r.ID, &r.Title, d.scan(&r.Amount), &r.Currency, &r.Note, d.scan(&r.Tags),
+		&r.Frequency, &r.Interval, &r.DayOfMonth, d.scan(&startsAt), d.scan(&r.EndsAt), d.scan(&r.LastRun), d.scan(&r.NextRun)}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	r.StartsAt = *startsAt
+	return nil
+}
+
+func (s *sqlStore) CreateRecurring(ctx context.Context, owner string, r Recurring) (Recurring, error) {
+	err := s.DB.QueryRowContext(ctx, s.query(`INSERT INTO recurring_expenses(owner_id, title, amount, currency, note, tags, frequency, interval_count, day_of_month, starts_at, ends_at, next_run)
+		values($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id`),
+		s.args(owner, r.Title, r.Amount, r.Currency, r.Note, r.Tags, r.Frequency, r.Interval, r.DayOfMonth, r.StartsAt, r.EndsAt, r.NextRun)...).Scan(&r.ID)
+	return r, err
+}
+
+func (s *sqlStore) GetRecurring(ctx context.Context, owner string, id int) (Recurring, error) {
+	var r Recurring
+	err := scanRecurring(s.dialect, s.DB.QueryRowContext(ctx, s.query("SELECT "+recurringColumns+" FROM recurring_expenses WHERE id=$1 AND owner_id=$2"), id, owner), &r)
+	if err == sql.ErrNoRows {
+		return r, errRecurringNotFound
+	}
+	return r, err
+}
+
+func (s *sqlStore) ListRecurring(ctx context.Context, owner string) ([]Recurring, error) {
+	rows, err := s.DB.QueryContext(ctx, s.query("SELECT "+recurringColumns+" FROM recurring_expenses WHERE owner_id=$1 ORDER BY id"), owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Recurring{}
+	for rows.Next() {
+		var r Recurring
+		if err := scanRecurring(s.dialect, rows, &r); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqlStore) UpdateRecurring(ctx context.Context, owner string, r Recurring) (Recurring, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return r, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, s.query("SELECT last_run FROM recurring_expenses WHERE id=$1 AND owner_id=$2"+s.dialect.forUpdate()), r.ID, owner)
+	switch err := row.Scan(s.dialect.scan(&r.LastRun)); err {
+	case nil:
+	case sql.ErrNoRows:
+		return r, errRecurringNotFound
+	default:
+		return r, err
+	}
+	r.reschedule()
+
+	_, err = tx.ExecContext(ctx, s.query(`UPDATE recurring_expenses SET title=$3, amount=$4, currency=$5, note=$6, tags=$7, frequency=$8, interval_count=$9,
+		day_of_month=$10, starts_at=$11, ends_at=$12, next_run=$13 WHERE id=$1 AND owner_id=$2`),
+		s.args(r.ID, owner, r.Title, r.Amount, r.Currency, r.Note, r.Tags, r.Frequency, r.Interval, r.DayOfMonth, r.StartsAt, r.EndsAt, r.NextRun)...)
+	if err != nil {
+		return r, err
+	}
+	return r, tx.Commit()
+}
+
+func (s *sqlStore) DeleteRecurring(ctx context.Context, owner string, id int) error {
+	res, err := s.DB.ExecContext(ctx, s.query("DELETE FROM recurring_expenses WHERE id=$1 AND owner_id=$2"), id, owner)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errRecurringNotFound
+	}
+	return err
+}
+
+func (s *sqlStore) DueRecurring(ctx context.Context, now time.Time) ([]int, error) {
+	rows, err := s.DB.QueryContext(ctx, s.query("SELECT id FROM recurring_expenses WHERE next_run <= $1 ORDER BY id"), s.args(now)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// RunRecurring only advances a schedule still at the run it read, so a run
+// taken in the meantime is not created twice. Where the dialect can lock
+// the template, concurrent schedulers wait for it instead.
+func (s *sqlStore) RunRecurring(ctx context.Context, id int, now time.Time) (Expense, bool, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Expense{}, false, err
+	}
+	defer tx.Rollback()
+
+	var r Recurring
+	var owner string
+	row := tx.QueryRowContext(ctx, s.query("SELECT "+recurringColumns+", owner_id FROM recurring_expenses WHERE id=$1 AND next_run <= $2"+s.dialect.forUpdate()), s.args(id, now)...)
+	switch err := scanRecurring(s.dialect, row, &r, &owner); err {
+	case nil:
+	case sql.ErrNoRows:
+		return Expense{}, false, nil
+	default:
+		return Expense{}, false, err
+	}
+
+	at := *r.NextRun
+	r.LastRun = &at
+	r.reschedule()
+	res, err := tx.ExecContext(ctx, s.query("UPDATE recurring_expenses SET last_run=$2, next_run=$3 WHERE id=$1 AND next_run=$2"), s.args(id, r.LastRun, r.NextRun)...)
+	if err != nil {
+		return Expense{}, false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return Expense{}, false, err
+	}
+	ex, err := s.createExpense(ctx, tx, owner, r.expense(at))
+	if err != nil {
+		return ex, false, err
+	}
+	return ex, true, tx.Commit()
+}
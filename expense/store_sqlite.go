@@ -0,0 +1,436 @@
+package expense
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	_ "modernc.org/sqlite"
+	"strconv"
+	"time"
+)
+
+// SQLiteStore implements Store on top of SQLite. Amounts are stored as
+// integer minor units, tags as a JSON array and timestamps as fixed width
+// UTC text so that they compare in order.
+type SQLiteStore struct {
+	sqlStore
+}
+
+func newSQLiteStore(db *sql.DB) *SQLiteStore {
+	return &SQLiteStore{sqlStore{DB: db, dialect: sqliteDialect{}, createExpense: createSQLiteExpense}}
+}
+
+// openSQLite opens the database file at path, creating it if needed.
+func openSQLite(path string) (*sql.DB, error) {
+	db, err := openTraced("sqlite", path, semconv.DBSystemSqlite)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time; a single connection also keeps
+	// ":memory:" databases from being opened once per connection.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("PRAGMA busy_timeout = 5000"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// OpenSQLiteStore opens the database file at path and migrates it.
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := openSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateUp(db, "sqlite"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return newSQLiteStore(db), nil
+}
+
+func (s *SQLiteStore) Ready(ctx context.Context) error {
+	return sqlReady(ctx, s.DB, "sqlite")
+}
+
+const sqliteTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+func sqliteTimeValue(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+type sqliteTime struct{ t **time.Time }
+
+func (s sqliteTime) Scan(src interface{}) error {
+	var v string
+	switch src := src.(type) {
+	case nil:
+		*s.t = nil
+		return nil
+	case string:
+		v = src
+	case []byte:
+		v = string(src)
+	default:
+		return fmt.Errorf("can not scan %T into time", src)
+	}
+	t, err := time.Parse(sqliteTimeLayout, v)
+	if err != nil {
+		return err
+	}
+	*s.t = &t
+	return nil
+}
+
+func sqliteTagsValue(tags []string) (interface{}, error) {
+	if tags == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(tags)
+	return string(b), err
+}
+
+type sqliteTags struct{ tags *[]string }
+
+func (s sqliteTags) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*s.tags = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(src), s.tags)
+	case []byte:
+		return json.Unmarshal(src, s.tags)
+	default:
+		return fmt.Errorf("can not scan %T into tags", src)
+	}
+}
+
+type sqliteMoney struct{ m *Money }
+
+func (s sqliteMoney) Scan(src interface{}) error {
+	v, ok := src.(int64)
+	if !ok {
+		return fmt.Errorf("can not scan %T into Money", src)
+	}
+	*s.m = Money(v)
+	return nil
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) placeholder(n int) string { return "?" + strconv.Itoa(n) }
+
+func (sqliteDialect) bind(v interface{}) interface{} {
+	switch v := v.(type) {
+	case Money:
+		return int64(v)
+	case time.Time:
+		return sqliteTimeValue(&v)
+	case *time.Time:
+		return sqliteTimeValue(v)
+	case []string:
+		tags, _ := sqliteTagsValue(v)
+		return tags
+	case []int:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return v
+}
+
+func (sqliteDialect) scan(dest interface{}) interface{} {
+	switch dest := dest.(type) {
+	case *Money:
+		return sqliteMoney{dest}
+	case *[]string:
+		return sqliteTags{dest}
+	case **time.Time:
+		return sqliteTime{dest}
+	}
+	return dest
+}
+
+// forUpdate is empty: SQLite has no row locks, and a write transaction
+// holds the whole database.
+func (sqliteDialect) forUpdate() string { return "" }
+
+func (sqliteDialect) hasTags(args *sqlArgs, tags []string, all bool) string {
+	want := args.add(tags)
+	if all {
+		return "NOT EXISTS (SELECT 1 FROM json_each(" + want + ") AS want WHERE want.value NOT IN (SELECT value FROM json_each(tags)))"
+	}
+	return "EXISTS (SELECT 1 FROM json_each(tags) WHERE value IN (SELECT value FROM json_each(" + want + ")))"
+}
+
+// contains relies on LIKE, which SQLite only folds for ASCII letters.
+func (sqliteDialect) contains(column, pattern string) string {
+	return column + " LIKE '%' || " + pattern + ` || '%' ESCAPE '\'`
+}
+
+func (sqliteDialect) idIn(args *sqlArgs, ids []int) string {
+	return "id IN (SELECT value FROM json_each(" + args.add(ids) + "))"
+}
+
+func (sqliteDialect) unnestTags(tags string) (string, string) {
+	return "LEFT JOIN json_each(" + tags + ") AS t ON true", "t.value"
+}
+
+func (sqliteDialect) tagIn(args *sqlArgs, column string, tags []string) string {
+	return column + " IN (SELECT value FROM json_each(" + args.add(tags) + "))"
+}
+
+// period works on the text of sqliteTimeLayout; weeks start on Monday as in
+// Postgres.
+func (sqliteDialect) period(unit, column string) string {
+	day := "substr(" + column + ", 1, 10)"
+	switch unit {
+	case PeriodWeek:
+		return "date(" + day + ", '-' || ((CAST(strftime('%w', " + day + ") AS INTEGER) + 6) % 7) || ' days')"
+	case PeriodMonth:
+		return "substr(" + column + ", 1, 7) || '-01'"
+	case PeriodYear:
+		return "substr(" + column + ", 1, 4) || '-01-01'"
+	}
+	return day
+}
+
+func (s *SQLiteStore) Create(ctx context.Context, owner string, ex Expense) (Expense, error) {
+	return createSQLiteExpense(ctx, s.DB, owner, ex)
+}
+
+func (s *SQLiteStore) Import(ctx context.Context, owner string, expenses []Expense) ([]Expense, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	created := make([]Expense, len(expenses))
+	for i, ex := range expenses {
+		if created[i], err = createSQLiteExpense(ctx, tx, owner, ex); err != nil {
+			return nil, fmt.Errorf("expense %d: %w", i+1, err)
+		}
+	}
+	return created, tx.Commit()
+}
+
+func createSQLiteExpense(ctx context.Context, db queryRower, owner string, ex Expense) (Expense, error) {
+	tags, err := sqliteTagsValue(ex.Tags)
+	if err != nil {
+		return ex, err
+	}
+	now := time.Now()
+	spentAt := ex.SpentAt
+	if spentAt == nil {
+		spentAt = &now
+	}
+	row := db.QueryRowContext(ctx, "INSERT INTO expenses(title, amount, currency, note, tags, spent_at, created_at, updated_at, owner_id) values(?1, ?2, ?3, ?4, ?5, ?6, ?7, ?7, ?8) RETURNING "+expenseColumns,
+		ex.Title, int64(ex.Amount), ex.Currency, ex.Note, tags, sqliteTimeValue(spentAt), sqliteTimeValue(&now), owner)
+	err = scanExpense(sqliteDialect{}, row, &ex)
+	return ex, err
+}
+
+// sqliteExportBatch is how many rows Export reads per query.
+var sqliteExportBatch = 500
+
+// Export reads keyset pages of sqliteExportBatch rows, so the store's single
+// connection is free for other requests while fn handles each page.
+func (s *SQLiteStore) Export(ctx context.Context, q ListQuery, fn func(Expense) error) error {
+	if len(q.Sort) == 0 {
+		q.Sort = []SortField{{Field: "id"}}
+	}
+	q.Limit, q.After = sqliteExportBatch, nil
+	for {
+		expenses, err := s.List(ctx, q)
+		if err != nil {
+			return err
+		}
+		for _, ex := range expenses {
+			if err := fn(ex); err != nil {
+				return err
+			}
+		}
+		if len(expenses) < q.Limit {
+			return nil
+		}
+		// The cursor goes through its JSON form, which is what keyset
+		// expects to decode.
+		if q.After, err = decodeCursor(encodeCursor(q.cursorFor(expenses[len(expenses)-1]))); err != nil {
+			return err
+		}
+	}
+}
+
+const sqliteUpdateSQL = "UPDATE expenses SET title=?2, amount=?3, currency=?4, note=?5, tags=?6, spent_at=COALESCE(?7, spent_at), updated_at=?8 WHERE id=?1"
+
+func (s *SQLiteStore) Update(ctx context.Context, owner string, ex Expense) (Expense, error) {
+	tags, err := sqliteTagsValue(ex.Tags)
+	if err != nil {
+		return ex, err
+	}
+	now := time.Now()
+	row := s.DB.QueryRowContext(ctx, sqliteUpdateSQL+" AND owner_id=?9 AND deleted_at IS NULL RETURNING "+expenseColumns,
+		ex.ID, ex.Title, int64(ex.Amount), ex.Currency, ex.Note, tags, sqliteTimeValue(ex.SpentAt), sqliteTimeValue(&now), owner)
+	err = scanExpense(sqliteDialect{}, row, &ex)
+	if err == sql.ErrNoRows {
+		return ex, errExpenseNotFound
+	}
+	return ex, err
+}
+
+func (s *SQLiteStore) Patch(ctx context.Context, owner string, id int, apply func(Expense) (Expense, error)) (Expense, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Expense{}, err
+	}
+	defer tx.Rollback()
+
+	ex := Expense{}
+	row := tx.QueryRowContext(ctx, "SELECT "+expenseColumns+" FROM expenses WHERE id=?1 AND owner_id=?2 AND deleted_at IS NULL", id, owner)
+	switch err := scanExpense(sqliteDialect{}, row, &ex); err {
+	case nil:
+	case sql.ErrNoRows:
+		return ex, errExpenseNotFound
+	default:
+		return ex, err
+	}
+
+	patched, err := apply(ex)
+	if err != nil {
+		return ex, err
+	}
+
+	tags, err := sqliteTagsValue(patched.Tags)
+	if err != nil {
+		return ex, err
+	}
+	now := time.Now()
+	row = tx.QueryRowContext(ctx, sqliteUpdateSQL+" RETURNING "+expenseColumns,
+		id, patched.Title, int64(patched.Amount), patched.Currency, patched.Note, tags, sqliteTimeValue(patched.SpentAt), sqliteTimeValue(&now))
+	if err := scanExpense(sqliteDialect{}, row, &patched); err != nil {
+		return patched, err
+	}
+	return patched, tx.Commit()
+}
+
+func (s *SQLiteStore) Delete(ctx context.Context, owner string, id int) error {
+	now := time.Now()
+	res, err := s.DB.ExecContext(ctx, "UPDATE expenses SET deleted_at=?3 WHERE id=?1 AND owner_id=?2 AND deleted_at IS NULL", id, owner, sqliteTimeValue(&now))
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errExpenseNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Restore(ctx context.Context, owner string, id int) (Expense, error) {
+	ex := Expense{}
+	now := time.Now()
+	row := s.DB.QueryRowContext(ctx, "UPDATE expenses SET deleted_at=NULL, updated_at=?3 WHERE id=?1 AND owner_id=?2 AND deleted_at IS NOT NULL RETURNING "+expenseColumns, id, owner, sqliteTimeValue(&now))
+	err := scanExpense(sqliteDialect{}, row, &ex)
+	if err == sql.ErrNoRows {
+		return ex, notFound("deleted expense")
+	}
+	return ex, err
+}
+
+func (s *SQLiteStore) UpsertRates(ctx context.Context, rates []ExchangeRate) ([]ExchangeRate, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for i := range rates {
+		r := &rates[i]
+		err := tx.QueryRowContext(ctx, `INSERT INTO exchange_rates(base, quote, rate, effective_date) values(?1, ?2, ?3, ?4)
+			ON CONFLICT (base, quote, effective_date) DO UPDATE SET rate=excluded.rate
+			RETURNING id`, r.Base, r.Quote, r.Rate.String(), r.EffectiveDate).Scan(&r.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rates, tx.Commit()
+}
+
+func (s *SQLiteStore) ListRates(ctx context.Context, base, quote string) ([]ExchangeRate, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT id, base, quote, rate, effective_date FROM exchange_rates
+		WHERE (?1 = '' OR base = ?1) AND (?2 = '' OR quote = ?2)
+		ORDER BY base, quote, effective_date DESC`, base, quote)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []ExchangeRate{}
+	for rows.Next() {
+		var rate ExchangeRate
+		if err := rows.Scan(&rate.ID, &rate.Base, &rate.Quote, &rate.Rate, &rate.EffectiveDate); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+	return rates, rows.Err()
+}
+
+func (s *SQLiteStore) FindRate(ctx context.Context, base, quote string, on time.Time) (ExchangeRate, error) {
+	rate := ExchangeRate{}
+	err := s.DB.QueryRowContext(ctx, `SELECT id, base, quote, rate, effective_date FROM exchange_rates
+		WHERE ((base=?1 AND quote=?2) OR (base=?2 AND quote=?1)) AND effective_date <= ?3
+		ORDER BY effective_date DESC, base=?1 DESC LIMIT 1`, base, quote, on.Format(dateLayout)).Scan(&rate.ID, &rate.Base, &rate.Quote, &rate.Rate, &rate.EffectiveDate)
+	if err == sql.ErrNoRows {
+		return rate, fmt.Errorf("%w from %s to %s on %s", errNoRate, base, quote, on.Format(dateLayout))
+	}
+	return rate, err
+}
+
+func (s *SQLiteStore) CreateAPIKey(ctx context.Context, owner, name, keyHash string) (APIKey, error) {
+	k := APIKey{Name: name, CreatedAt: time.Now()}
+	err := s.DB.QueryRowContext(ctx, "INSERT INTO api_keys(owner_id, name, key_hash, created_at) values(?1, ?2, ?3, ?4) RETURNING id", owner, name, keyHash, sqliteTimeValue(&k.CreatedAt)).Scan(&k.ID)
+	return k, err
+}
+
+func (s *SQLiteStore) ListAPIKeys(ctx context.Context, owner string) ([]APIKey, error) {
+	rows, err := s.DB.QueryContext(ctx, "SELECT id, name, created_at, revoked_at FROM api_keys WHERE owner_id=?1 ORDER BY id", owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		var createdAt *time.Time
+		if err := rows.Scan(&k.ID, &k.Name, sqliteTime{&createdAt}, sqliteTime{&k.RevokedAt}); err != nil {
+			return nil, err
+		}
+		k.CreatedAt = *createdAt
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (s *SQLiteStore) RevokeAPIKey(ctx context.Context, owner string, id int) error {
+	now := time.Now()
+	res, err := s.DB.ExecContext(ctx, "UPDATE api_keys SET revoked_at=?3 WHERE id=?1 AND owner_id=?2 AND revoked_at IS NULL", id, owner, sqliteTimeValue(&now))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errAPIKeyNotFound
+	}
+	return err
+}
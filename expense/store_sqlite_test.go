@@ -0,0 +1,83 @@
+//go:build unit
+// +build unit
+
+package expense
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/exp/slog"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "expenses.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+
+	t.Run("recurring runs survive a restart", func(t *testing.T) {
+		ctx := context.Background()
+		path := filepath.Join(t.TempDir(), "expenses.db")
+		now := time.Date(2023, 1, 3, 12, 0, 0, 0, time.UTC)
+		run := func() int {
+			store, err := OpenSQLiteStore(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			s := NewScheduler(store, time.Minute, slog.New(slog.NewJSONHandler(io.Discard)))
+			s.now = func() time.Time { return now }
+			return s.RunDue(ctx)
+		}
+
+		store, err := OpenSQLiteStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := Recurring{Title: "coffee", Amount: 6000, Currency: "THB", Frequency: FrequencyDaily, Interval: 1, StartsAt: time.Date(2023, 1, 1, 8, 0, 0, 0, time.UTC)}
+		r.reschedule()
+		_, err = store.CreateRecurring(ctx, "alice", r)
+		assert.NoError(t, err)
+		assert.NoError(t, store.Close())
+
+		assert.Equal(t, 3, run())
+		assert.Equal(t, 0, run())
+		now = now.AddDate(0, 0, 1)
+		assert.Equal(t, 1, run())
+	})
+
+	t.Run("exports free the connection between batches", func(t *testing.T) {
+		ctx := context.Background()
+		store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "expenses.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		defer func(batch int) { sqliteExportBatch = batch }(sqliteExportBatch)
+		sqliteExportBatch = 2
+		for i := 1; i <= 5; i++ {
+			_, err := store.Create(ctx, "alice", Expense{Title: fmt.Sprint("coffee ", i), Amount: Money(i * 100), Currency: "THB"})
+			assert.NoError(t, err)
+		}
+
+		sort, _ := parseSort("-amount")
+		var titles []string
+		err = store.Export(ctx, ListQuery{OwnerID: "alice", Sort: sort}, func(ex Expense) error {
+			titles = append(titles, ex.Title)
+			pingCtx, cancel := context.WithTimeout(ctx, time.Second)
+			defer cancel()
+			return store.Ready(pingCtx)
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"coffee 5", "coffee 4", "coffee 3", "coffee 2", "coffee 1"}, titles)
+	})
+}
@@ -0,0 +1,375 @@
+//go:build unit
+// +build unit
+
+package expense
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/exp/slog"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func storeRequest(t *testing.T, h *handler, method, target, body string, handle func(*handler, echo.Context) error, params ...string) *httptest.ResponseRecorder {
+	e := echo.New()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := withOwner(e.NewContext(req, rec))
+	if len(params) > 0 {
+		c.SetParamNames("id")
+		c.SetParamValues(params...)
+	}
+	if err := handle(h, c); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+// testStore runs the behaviour every Store shares against stores returned
+// by open.
+func testStore(t *testing.T, open func(t *testing.T) Store) {
+	ctx := context.Background()
+
+	t.Run("expenses round trip through the handlers", func(t *testing.T) {
+		h := NewHandler(open(t))
+
+		for _, body := range []string{
+			`{"title": "coffee", "amount": 60, "tags": ["beverage"]}`,
+			`{"title": "ramen", "amount": 250, "tags": ["food"]}`,
+			`{"title": "smoothie", "amount": "79.50", "tags": ["food", "beverage"]}`,
+		} {
+			rec := storeRequest(t, h, http.MethodPost, "/expenses", body, (*handler).CreateExpensesHandler)
+			assert.Equal(t, http.StatusCreated, rec.Code)
+		}
+
+		rec := storeRequest(t, h, http.MethodGet, "/expenses?tag=beverage&sort=-amount&limit=1", "", (*handler).GetExpensesHandler)
+		var page Page
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+		if assert.Len(t, page.Data, 1) {
+			assert.Equal(t, "smoothie", page.Data[0].Title)
+		}
+
+		rec = storeRequest(t, h, http.MethodGet, "/expenses?tag=beverage&sort=-amount&limit=1&cursor="+page.NextCursor, "", (*handler).GetExpensesHandler)
+		page = Page{}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+		if assert.Len(t, page.Data, 1) {
+			assert.Equal(t, "coffee", page.Data[0].Title)
+		}
+		assert.Empty(t, page.NextCursor)
+
+		for query, want := range map[string][]string{
+			"tag=food,beverage&tag_match=all":    {"smoothie"},
+			"title=RAM":                          {"ramen"},
+			"ids=1,3&sort=title":                 {"coffee", "smoothie"},
+			"min_amount=70&max_amount=100":       {"smoothie"},
+			"spent_from=2000-01-01&sort=-amount": {"ramen", "smoothie", "coffee"},
+		} {
+			rec := storeRequest(t, h, http.MethodGet, "/expenses?"+query, "", (*handler).GetExpensesHandler)
+			var got []Expense
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			titles := []string{}
+			for _, ex := range got {
+				titles = append(titles, ex.Title)
+			}
+			assert.Equal(t, want, titles, query)
+		}
+
+		rec = storeRequest(t, h, http.MethodPut, "/expenses/2", `{"title": "tonkotsu ramen", "amount": 280, "tags": ["food"]}`, (*handler).UpdateExpensesByIdHandler, "2")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"title":"tonkotsu ramen","amount":280`)
+
+		rec = storeRequest(t, h, http.MethodPatch, "/expenses/3", `{"note": "half sugar", "tags": ["beverage"]}`, (*handler).PatchExpensesByIdHandler, "3")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"amount":79.5,"currency":"THB","note":"half sugar","tags":["beverage"]`)
+
+		rec = storeRequest(t, h, http.MethodDelete, "/expenses/1", "", (*handler).DeleteExpensesByIdHandler, "1")
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		rec = storeRequest(t, h, http.MethodGet, "/expenses/1", "", (*handler).GetExpensesByIdHandler, "1")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		rec = storeRequest(t, h, http.MethodGet, "/expenses/trash", "", (*handler).GetTrashExpensesHandler)
+		assert.Contains(t, rec.Body.String(), `"title":"coffee"`)
+		rec = storeRequest(t, h, http.MethodPost, "/expenses/1/restore", "", (*handler).RestoreExpensesByIdHandler, "1")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		rec = storeRequest(t, h, http.MethodDelete, "/expenses/1", "", (*handler).DeleteExpensesByIdHandler, "1")
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+
+		rec = storeRequest(t, h, http.MethodGet, "/expenses", "", (*handler).GetExpensesHandler)
+		var all []Expense
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &all))
+		assert.Len(t, all, 2)
+	})
+
+	t.Run("expenses of other owners are not visible", func(t *testing.T) {
+		store := open(t)
+		ex, err := store.Create(ctx, "bob", Expense{Title: "coffee", Amount: 6000, Currency: "THB"})
+		assert.NoError(t, err)
+
+		_, err = store.Get(ctx, "alice", ex.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, store.Delete(ctx, "alice", ex.ID), ErrNotFound)
+	})
+
+	t.Run("summaries group by tag, period and currency", func(t *testing.T) {
+		store := open(t)
+		h := NewHandler(store)
+		day := func(d string) *time.Time {
+			at, _ := time.Parse(time.RFC3339, d)
+			return &at
+		}
+		for _, ex := range []Expense{
+			{Title: "coffee", Amount: 6000, Currency: "THB", Tags: []string{"beverage"}, SpentAt: day("2023-01-02T08:00:00Z")},
+			{Title: "ramen", Amount: 25000, Currency: "THB", Tags: []string{"food"}, SpentAt: day("2023-01-08T12:00:00Z")},
+			{Title: "smoothie", Amount: 7950, Currency: "THB", Tags: []string{"food", "beverage"}, SpentAt: day("2023-02-01T15:00:00Z")},
+			{Title: "bagel", Amount: 450, Currency: "USD", Tags: []string{"food"}, SpentAt: day("2023-02-03T09:00:00Z")},
+			{Title: "taxi", Amount: 12000, Currency: "THB", SpentAt: day("2023-02-04T23:30:00Z")},
+		} {
+			_, err := store.Create(ctx, "alice", ex)
+			assert.NoError(t, err)
+		}
+		_, err := store.Create(ctx, "bob", Expense{Title: "tea", Amount: 100, Currency: "THB", SpentAt: day("2023-01-02T08:00:00Z")})
+		assert.NoError(t, err)
+		deleted, err := store.Create(ctx, "alice", Expense{Title: "refunded", Amount: 100000, Currency: "THB", SpentAt: day("2023-01-02T08:00:00Z")})
+		assert.NoError(t, err)
+		assert.NoError(t, store.Delete(ctx, "alice", deleted.ID))
+
+		for query, want := range map[string]string{
+			"group_by=month": `{"group_by":["month"],"data":[` +
+				`{"period":"2023-01-01","currency":"THB","count":2,"total":310,"average":155,"min":60,"max":250},` +
+				`{"period":"2023-02-01","currency":"THB","count":2,"total":199.5,"average":99.75,"min":79.5,"max":120},` +
+				`{"period":"2023-02-01","currency":"USD","count":1,"total":4.5,"average":4.5,"min":4.5,"max":4.5}]}`,
+			"group_by=tag&spent_to=2023-02-01": `{"group_by":["tag"],"data":[` +
+				`{"tag":"beverage","currency":"THB","count":2,"total":139.5,"average":69.75,"min":60,"max":79.5},` +
+				`{"tag":"food","currency":"THB","count":2,"total":329.5,"average":164.75,"min":79.5,"max":250}]}`,
+			"group_by=tag,week&tag=food&spent_from=2023-01-03": `{"group_by":["tag","week"],"data":[` +
+				`{"tag":"food","period":"2023-01-02","currency":"THB","count":1,"total":250,"average":250,"min":250,"max":250},` +
+				`{"tag":"food","period":"2023-01-30","currency":"THB","count":1,"total":79.5,"average":79.5,"min":79.5,"max":79.5},` +
+				`{"tag":"food","period":"2023-01-30","currency":"USD","count":1,"total":4.5,"average":4.5,"min":4.5,"max":4.5}]}`,
+			"group_by=year,tag&min_amount=100": `{"group_by":["tag","year"],"data":[` +
+				`{"tag":"","period":"2023-01-01","currency":"THB","count":1,"total":120,"average":120,"min":120,"max":120},` +
+				`{"tag":"food","period":"2023-01-01","currency":"THB","count":1,"total":250,"average":250,"min":250,"max":250}]}`,
+			"group_by=day&min_amount=1000": `{"group_by":["day"],"data":[]}`,
+		} {
+			rec := storeRequest(t, h, http.MethodGet, "/reports/summary?"+query, "", (*handler).GetSummaryReportHandler)
+			assert.Equal(t, http.StatusOK, rec.Code, query)
+			assert.JSONEq(t, want, rec.Body.String(), query)
+		}
+	})
+
+	t.Run("budgets track spending in their period", func(t *testing.T) {
+		h := NewHandler(open(t))
+
+		rec := storeRequest(t, h, http.MethodPost, "/budgets", `{"tag": "food", "amount": 1000}`, (*handler).CreateBudgetHandler)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		var budget Budget
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &budget))
+		assert.Equal(t, Budget{ID: budget.ID, Tag: "food", Amount: 100000, Currency: "THB", Period: PeriodMonth}, budget)
+		id := strconv.Itoa(budget.ID)
+
+		var alerts []string
+		for _, body := range []string{
+			`{"title": "groceries", "amount": 700, "tags": ["food"], "spent_at": "2023-01-10T12:00:00Z"}`,
+			`{"title": "dinner", "amount": 150, "tags": ["food"], "spent_at": "2023-01-20T12:00:00Z"}`,
+			`{"title": "lunch", "amount": 100, "tags": ["food"], "spent_at": "2023-01-21T12:00:00Z"}`,
+			`{"title": "feast", "amount": 900, "tags": ["food"], "spent_at": "2023-02-01T12:00:00Z"}`,
+			`{"title": "ramen", "amount": 90, "tags": ["food"], "spent_at": "2023-01-22T12:00:00Z"}`,
+		} {
+			rec := storeRequest(t, h, http.MethodPost, "/expenses", body, (*handler).CreateExpensesHandler)
+			assert.Equal(t, http.StatusCreated, rec.Code)
+			var res expenseResult
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			state := BudgetOK
+			if len(res.BudgetAlerts) > 0 {
+				state = res.BudgetAlerts[0].State
+			}
+			alerts = append(alerts, state)
+		}
+		assert.Equal(t, []string{BudgetOK, BudgetWarning, BudgetOK, BudgetWarning, BudgetExceeded}, alerts)
+
+		rec = storeRequest(t, h, http.MethodGet, "/budgets/"+id+"/status?on=2023-01-31", "", (*handler).GetBudgetStatusHandler, id)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id":`+id+`,"tag":"food","amount":1000,"currency":"THB","period":"month",`+
+			`"period_start":"2023-01-01","period_end":"2023-02-01","spent":1040,"remaining":0,"percent":104,"state":"exceeded"}`, rec.Body.String())
+
+		rec = storeRequest(t, h, http.MethodPut, "/budgets/"+id, `{"tag": "food", "amount": 2000, "period": "year"}`, (*handler).UpdateBudgetByIdHandler, id)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		rec = storeRequest(t, h, http.MethodGet, "/budgets/"+id+"/status?on=2023-06-01", "", (*handler).GetBudgetStatusHandler, id)
+		assert.JSONEq(t, `{"id":`+id+`,"tag":"food","amount":2000,"currency":"THB","period":"year",`+
+			`"period_start":"2023-01-01","period_end":"2024-01-01","spent":1940,"remaining":60,"percent":97,"state":"warning"}`, rec.Body.String())
+
+		rec = storeRequest(t, h, http.MethodDelete, "/budgets/"+id, "", (*handler).DeleteBudgetByIdHandler, id)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		rec = storeRequest(t, h, http.MethodGet, "/budgets/"+id, "", (*handler).GetBudgetByIdHandler, id)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("updates only flag budgets they push further", func(t *testing.T) {
+		h := NewHandler(open(t))
+		storeRequest(t, h, http.MethodPost, "/budgets", `{"tag": "food", "amount": 100}`, (*handler).CreateBudgetHandler)
+		rec := storeRequest(t, h, http.MethodPost, "/expenses", `{"title": "lunch", "amount": 90, "tags": ["food"], "spent_at": "2023-01-10T12:00:00Z"}`, (*handler).CreateExpensesHandler)
+		var created expenseResult
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+		id := strconv.Itoa(created.ID)
+
+		for _, step := range []struct{ amount, want string }{
+			{"85", ""},
+			{"120", BudgetExceeded},
+			{"130", ""},
+			{"50", ""},
+			{"80", BudgetWarning},
+		} {
+			body := `{"title": "lunch", "amount": ` + step.amount + `, "tags": ["food"], "spent_at": "2023-01-10T12:00:00Z"}`
+			rec := storeRequest(t, h, http.MethodPut, "/expenses/"+id, body, (*handler).UpdateExpensesByIdHandler, id)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			var res expenseResult
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			state := ""
+			if len(res.BudgetAlerts) > 0 {
+				state = res.BudgetAlerts[0].State
+			}
+			assert.Equal(t, step.want, state, step.amount)
+		}
+	})
+
+	t.Run("recurring expenses are created once per run", func(t *testing.T) {
+		store := open(t)
+		h := NewHandler(store)
+
+		rec := storeRequest(t, h, http.MethodPost, "/recurring",
+			`{"title": "rent", "amount": 12000, "tags": ["home"], "frequency": "monthly", "day_of_month": 1, "starts_at": "2023-01-01T09:00:00Z", "ends_at": "2023-12-31T00:00:00Z"}`,
+			(*handler).CreateRecurringHandler)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		var r Recurring
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &r))
+		if assert.NotNil(t, r.NextRun) {
+			assert.Equal(t, "2023-01-01T09:00:00Z", r.NextRun.UTC().Format(time.RFC3339))
+		}
+
+		s := NewScheduler(store, time.Minute, slog.New(slog.NewJSONHandler(io.Discard)))
+		s.now = func() time.Time { return time.Date(2023, 3, 15, 0, 0, 0, 0, time.UTC) }
+		assert.Equal(t, 3, s.RunDue(ctx))
+		assert.Equal(t, 0, s.RunDue(ctx))
+
+		expenses, err := store.List(ctx, ListQuery{OwnerID: "alice", Sort: []SortField{{Field: "id"}}, Limit: 10})
+		assert.NoError(t, err)
+		var spent []string
+		for _, ex := range expenses {
+			spent = append(spent, ex.SpentAt.UTC().Format("2006-01-02"))
+			assert.Equal(t, Expense{Title: "rent", Amount: 1200000, Currency: "THB", Tags: []string{"home"}},
+				Expense{Title: ex.Title, Amount: ex.Amount, Currency: ex.Currency, Tags: ex.Tags})
+		}
+		assert.Equal(t, []string{"2023-01-01", "2023-02-01", "2023-03-01"}, spent)
+
+		id := strconv.Itoa(r.ID)
+		rec = storeRequest(t, h, http.MethodPut, "/recurring/"+id,
+			`{"title": "rent", "amount": 13000, "tags": ["home"], "frequency": "monthly", "day_of_month": 5, "starts_at": "2023-01-01T09:00:00Z"}`,
+			(*handler).UpdateRecurringByIdHandler, id)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		r = Recurring{}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &r))
+		if assert.NotNil(t, r.LastRun) && assert.NotNil(t, r.NextRun) {
+			assert.Equal(t, "2023-03-01", r.LastRun.UTC().Format("2006-01-02"))
+			assert.Equal(t, "2023-03-05", r.NextRun.UTC().Format("2006-01-02"))
+		}
+
+		rec = storeRequest(t, h, http.MethodDelete, "/recurring/"+id, "", (*handler).DeleteRecurringByIdHandler, id)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		s.now = func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) }
+		assert.Equal(t, 0, s.RunDue(ctx))
+		rec = storeRequest(t, h, http.MethodGet, "/recurring/"+id, "", (*handler).GetRecurringByIdHandler, id)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("recurring runs catch up a few at a time", func(t *testing.T) {
+		store := open(t)
+		r := Recurring{Title: "coffee", Amount: 6000, Currency: "THB", Frequency: FrequencyDaily, Interval: 1, StartsAt: time.Date(2023, 1, 1, 8, 0, 0, 0, time.UTC)}
+		r.reschedule()
+		_, err := store.CreateRecurring(ctx, "alice", r)
+		assert.NoError(t, err)
+
+		s := NewScheduler(store, time.Minute, slog.New(slog.NewJSONHandler(io.Discard)))
+		s.MaxRuns = 3
+		s.now = func() time.Time { return time.Date(2023, 1, 10, 12, 0, 0, 0, time.UTC) }
+		var runs []int
+		for i := 0; i < 5; i++ {
+			runs = append(runs, s.RunDue(ctx))
+		}
+		assert.Equal(t, []int{3, 3, 3, 1, 0}, runs)
+	})
+
+	t.Run("imports store every row together", func(t *testing.T) {
+		store := open(t)
+		now := time.Now()
+		created, err := store.Import(ctx, "alice", []Expense{
+			{Title: "rent", Amount: 1200000, Currency: "THB", Tags: []string{"home"}, SpentAt: &now},
+			{Title: "noodles", Amount: 12345, Currency: "THB", Tags: []string{}, SpentAt: &now},
+		})
+		if assert.NoError(t, err) && assert.Len(t, created, 2) {
+			assert.Equal(t, "noodles", created[1].Title)
+			assert.NotEqual(t, created[0].ID, created[1].ID)
+			got, err := store.Get(ctx, "alice", created[1].ID)
+			assert.NoError(t, err)
+			assert.Equal(t, Money(12345), got.Amount)
+		}
+	})
+
+	t.Run("exports pass every matching row in order", func(t *testing.T) {
+		store := open(t)
+		now := time.Now()
+		_, err := store.Import(ctx, "alice", []Expense{
+			{Title: "rent", Amount: 1200000, Currency: "THB", Tags: []string{"home"}, SpentAt: &now},
+			{Title: "noodles", Amount: 12345, Currency: "THB", Tags: []string{"food"}, SpentAt: &now},
+			{Title: "coffee", Amount: 9000, Currency: "THB", Tags: []string{"food"}, SpentAt: &now},
+		})
+		assert.NoError(t, err)
+		_, err = store.Create(ctx, "bob", Expense{Title: "bread", Amount: 5000, Currency: "THB", Tags: []string{"food"}, SpentAt: &now})
+		assert.NoError(t, err)
+
+		sort, _ := parseSort("-amount")
+		var titles []string
+		err = store.Export(ctx, ListQuery{OwnerID: "alice", Tags: []string{"food"}, TagMatch: TagMatchAny, Sort: sort}, func(ex Expense) error {
+			titles = append(titles, ex.Title)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"noodles", "coffee"}, titles)
+
+		stop := errors.New("stop")
+		calls := 0
+		err = store.Export(ctx, ListQuery{OwnerID: "alice", Sort: sort}, func(ex Expense) error {
+			calls++
+			return stop
+		})
+		assert.ErrorIs(t, err, stop)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("rates use the latest effective pair in either direction", func(t *testing.T) {
+		store := open(t)
+		rate, _ := ParseRate("35")
+		newer, _ := ParseRate("34")
+		_, err := store.UpsertRates(ctx, []ExchangeRate{
+			{Base: "USD", Quote: "THB", Rate: rate, EffectiveDate: "2022-12-01"},
+			{Base: "USD", Quote: "THB", Rate: newer, EffectiveDate: "2022-12-20"},
+		})
+		assert.NoError(t, err)
+
+		found, err := store.FindRate(ctx, "THB", "USD", time.Date(2022, 12, 24, 0, 0, 0, 0, time.UTC))
+		if assert.NoError(t, err) {
+			assert.Equal(t, "34", found.Rate.String())
+			assert.Equal(t, "1/34", rateFor("THB", found).String())
+		}
+
+		_, err = store.FindRate(ctx, "USD", "THB", time.Date(2022, 11, 30, 0, 0, 0, 0, time.UTC))
+		assert.ErrorIs(t, err, errNoRate)
+	})
+}
@@ -0,0 +1,80 @@
+package expense
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/XSAM/otelsql"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+)
+
+// serviceName names the service in spans unless OTEL_SERVICE_NAME is set.
+const serviceName = "expenses"
+
+// InitTracing installs the global tracer provider for exporter, "otlp",
+// "stdout" or "none". The OTLP exporter speaks HTTP and reads the standard
+// OTEL_EXPORTER_OTLP_* variables. The returned function flushes pending
+// spans and must be called before exiting.
+func InitTracing(ctx context.Context, exporter string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exp sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exp, err = otlptracehttp.New(ctx)
+	case "stdout":
+		exp, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceNameKey.String(serviceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Tracing starts a server span for every request, named after its route
+// pattern and continuing the trace of an incoming traceparent header.
+// Handlers pass the request context on to the store, so SQL spans become
+// its children.
+func Tracing() echo.MiddlewareFunc {
+	return otelecho.Middleware(serviceName)
+}
+
+// openTraced opens a database whose statements each get a span. Rows,
+// connection resets and connects are left out to keep one span per
+// statement.
+func openTraced(driver, dsn string, system attribute.KeyValue) (*sql.DB, error) {
+	return otelsql.Open(driver, dsn,
+		otelsql.WithAttributes(system),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitRows:             true,
+			OmitConnectorConnect: true,
+		}),
+	)
+}
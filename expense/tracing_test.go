@@ -0,0 +1,80 @@
+//go:build unit
+// +build unit
+
+package expense
+
+import (
+	"context"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestTracing(t *testing.T) {
+	t.Run("requests continue the incoming trace down to sql", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+		otel.SetTracerProvider(tp)
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+		defer func() {
+			otel.SetTracerProvider(prevProvider)
+			otel.SetTextMapPropagator(prevPropagator)
+		}()
+
+		store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "expenses.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		ex, err := store.Create(context.Background(), "alice", Expense{Title: "coffee"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := NewHandler(store)
+
+		e := echo.New()
+		e.Use(Tracing())
+		e.GET("/expenses/:id", h.GetExpensesByIdHandler, func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error { return next(withOwner(c)) }
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/expenses/"+strconv.Itoa(ex.ID), nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.NoError(t, tp.ForceFlush(context.Background()))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var server sdktrace.ReadOnlySpan
+		queries := map[trace.SpanID]int{}
+		for _, span := range recorder.Ended() {
+			switch span.SpanKind() {
+			case trace.SpanKindServer:
+				server = span
+			case trace.SpanKindClient:
+				queries[span.Parent().SpanID()]++
+			}
+		}
+		if assert.NotNil(t, server) {
+			assert.Equal(t, "/expenses/:id", server.Name())
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+			assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+			assert.Equal(t, 1, queries[server.SpanContext().SpanID()])
+		}
+	})
+
+	t.Run("unknown exporters are rejected", func(t *testing.T) {
+		_, err := InitTracing(context.Background(), "zipkin")
+		assert.EqualError(t, err, `unknown trace exporter "zipkin"`)
+	})
+}
@@ -2,34 +2,51 @@ package expense
 
 import (
 	"github.com/labstack/echo/v4"
-	"github.com/lib/pq"
 	"net/http"
 	"strconv"
 )
 
 func (h *handler) UpdateExpensesByIdHandler(c echo.Context) error {
 
+	owner, err := ownerID(c)
+	if err != nil {
+		return err
+	}
+
 	rowID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, Err{Message: err.Error()})
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
 	}
 
 	ex := Expense{}
 	err = c.Bind(&ex)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, Err{Message: err.Error()})
+		return errorJSON(c, http.StatusBadRequest, Err{Message: err.Error()})
 	}
 
-	stmt, err := h.DB.Prepare("UPDATE expenses SET title=$2 , amount=$3, note=$4, tags=$5 WHERE id=$1;")
+	normalizeExpense(&ex)
+	if errs := validateExpense(ex); len(errs) > 0 {
+		return errorJSON(c, http.StatusUnprocessableEntity, validationErr(errs))
+	}
 
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, Err{Message: err.Error()})
+	ex.ID = rowID
+	ctx, cancel := h.dbContext(c)
+	defer cancel()
+
+	// The replaced expense no longer counts against its budgets, so it has
+	// to be read before it is overwritten.
+	var prev *Expense
+	budgets := h.ownerBudgets(c, owner)
+	if len(budgets) > 0 {
+		if old, err := h.Store.Get(ctx, owner, rowID); err == nil {
+			prev = &old
+		}
 	}
 
-	if _, err := stmt.Exec(rowID, ex.Title, ex.Amount, ex.Note, pq.Array(ex.Tags)); err != nil {
-		return c.JSON(http.StatusInternalServerError, Err{Message: err.Error()})
+	ex, err = h.Store.Update(ctx, owner, ex)
+	if err != nil {
+		return storeError(c, err)
 	}
-	ex.ID = rowID
-	return c.JSON(http.StatusOK, ex)
+	return c.JSON(http.StatusOK, h.withBudgetAlerts(c, owner, budgets, ex, prev))
 
 }
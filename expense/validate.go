@@ -0,0 +1,108 @@
+package expense
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxTitleLength = 200
+	maxNoteLength  = 1000
+	maxTags        = 20
+	maxTagLength   = 50
+	maxAmount      = Money(99999999999999)
+)
+
+const (
+	CodeRequired  = "required"
+	CodeTooLong   = "too_long"
+	CodeTooMany   = "too_many"
+	CodeMin       = "min"
+	CodeMax       = "max"
+	CodeInvalid   = "invalid"
+	CodeScale     = "scale"
+	CodeDuplicate = "duplicate"
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError carries every rule an expense breaks.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	return "validation failed"
+}
+
+func validationErr(errs []FieldError) Err {
+	return Err{Message: "validation failed", Errors: errs}
+}
+
+// normalizeExpense trims free text and fills in the default currency before
+// validation.
+func normalizeExpense(ex *Expense) {
+	ex.Title = strings.TrimSpace(ex.Title)
+	ex.Currency = strings.ToUpper(strings.TrimSpace(ex.Currency))
+	if ex.Currency == "" {
+		ex.Currency = DefaultCurrency
+	}
+	for i, tag := range ex.Tags {
+		ex.Tags[i] = strings.TrimSpace(tag)
+	}
+}
+
+// validateExpense returns every rule ex breaks, so clients can highlight all
+// offending inputs at once.
+func validateExpense(ex Expense) []FieldError {
+	var errs []FieldError
+	add := func(field, code, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if ex.Title == "" {
+		add("title", CodeRequired, "title is required")
+	} else if utf8.RuneCountInString(ex.Title) > maxTitleLength {
+		add("title", CodeTooLong, "title must be at most %d characters", maxTitleLength)
+	}
+
+	if ex.Amount <= 0 {
+		add("amount", CodeMin, "amount must be greater than zero")
+	} else if ex.Amount > maxAmount {
+		add("amount", CodeMax, "amount must be at most %s", maxAmount)
+	}
+
+	if digits, ok := currencies[ex.Currency]; !ok {
+		add("currency", CodeInvalid, "currency %q is not a supported ISO 4217 code", ex.Currency)
+	} else if !fitsMinorUnits(ex.Amount, digits) {
+		add("amount", CodeScale, "%s amounts must not have more than %d decimal places", ex.Currency, digits)
+	}
+
+	if utf8.RuneCountInString(ex.Note) > maxNoteLength {
+		add("note", CodeTooLong, "note must be at most %d characters", maxNoteLength)
+	}
+
+	if len(ex.Tags) > maxTags {
+		add("tags", CodeTooMany, "at most %d tags are allowed", maxTags)
+	}
+	seen := map[string]bool{}
+	for i, tag := range ex.Tags {
+		field := fmt.Sprintf("tags[%d]", i)
+		switch {
+		case tag == "":
+			add(field, CodeRequired, "tag must not be empty")
+		case utf8.RuneCountInString(tag) > maxTagLength:
+			add(field, CodeTooLong, "tag must be at most %d characters", maxTagLength)
+		case seen[strings.ToLower(tag)]:
+			add(field, CodeDuplicate, "tag %q is listed more than once", tag)
+		}
+		seen[strings.ToLower(tag)] = true
+	}
+
+	return errs
+}
@@ -0,0 +1,274 @@
+// Package migrate applies the numbered SQL migrations embedded for each
+// supported database. A migration is a pair of files named
+// <version>_<name>.up.sql and <version>_<name>.down.sql.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
+var migrations embed.FS
+
+// lockKey is the Postgres advisory lock held while migrating, so replicas
+// starting together apply each migration once.
+const lockKey = 7271810
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Migration
+	AppliedAt string
+}
+
+type Migrator struct {
+	DB         *sql.DB
+	Dialect    string
+	Migrations []Migration
+}
+
+// New returns a Migrator for the migrations of dialect, "postgres" or
+// "sqlite".
+func New(db *sql.DB, dialect string) (*Migrator, error) {
+	sub, err := fs.Sub(migrations, dialect)
+	if err != nil {
+		return nil, err
+	}
+	ms, err := Load(sub)
+	if err != nil {
+		return nil, err
+	}
+	if len(ms) == 0 {
+		return nil, fmt.Errorf("no migrations for %q", dialect)
+	}
+	return &Migrator{DB: db, Dialect: dialect, Migrations: ms}, nil
+}
+
+// Load reads the migrations in the root of fsys ordered by version. Every
+// version needs both an up and a down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, file := range files {
+		base := path.Base(file)
+		name, direction := strings.TrimSuffix(base, ".sql"), ""
+		switch {
+		case strings.HasSuffix(name, ".up"):
+			name, direction = strings.TrimSuffix(name, ".up"), "up"
+		case strings.HasSuffix(name, ".down"):
+			name, direction = strings.TrimSuffix(name, ".down"), "down"
+		default:
+			return nil, fmt.Errorf("migration %s is neither .up.sql nor .down.sql", base)
+		}
+		num, label, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(num)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s does not start with a version number", base)
+		}
+
+		body, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migration %d is named both %q and %q", version, m.Name, label)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	ms := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both up and down files", m.Version, m.Name)
+		}
+		ms = append(ms, *m)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	return ms, nil
+}
+
+func (m *Migrator) placeholder(n int) string {
+	if m.Dialect == "postgres" {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// session runs fn on one connection that holds the migration lock and has
+// the schema_migrations table in place.
+func (m *Migrator) session(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	createTable := "CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP)"
+	if m.Dialect == "postgres" {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+			return fmt.Errorf("acquire migration lock: %w", err)
+		}
+		defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lockKey)
+		createTable = "CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at TIMESTAMPTZ NOT NULL DEFAULT now())"
+	}
+	if _, err := conn.ExecContext(ctx, createTable); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func applied(conn *sql.Conn) (map[int]string, error) {
+	rows, err := conn.QueryContext(context.Background(), "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := map[int]string{}
+	for rows.Next() {
+		var version int
+		var at string
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		versions[version] = at
+	}
+	return versions, rows.Err()
+}
+
+// step runs one migration and records it in the same transaction.
+func (m *Migrator) step(conn *sql.Conn, body, record string, args ...interface{}) error {
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Up applies every pending migration in order and returns them.
+func (m *Migrator) Up() ([]Migration, error) {
+	var done []Migration
+	err := m.session(func(conn *sql.Conn) error {
+		versions, err := applied(conn)
+		if err != nil {
+			return err
+		}
+		record := "INSERT INTO schema_migrations(version, name) values(" + m.placeholder(1) + ", " + m.placeholder(2) + ")"
+		for _, mg := range m.Migrations {
+			if _, ok := versions[mg.Version]; ok {
+				continue
+			}
+			if err := m.step(conn, mg.Up, record, mg.Version, mg.Name); err != nil {
+				return fmt.Errorf("migrate up %d_%s: %w", mg.Version, mg.Name, err)
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the latest n applied migrations and returns them.
+func (m *Migrator) Down(n int) ([]Migration, error) {
+	var done []Migration
+	err := m.session(func(conn *sql.Conn) error {
+		versions, err := applied(conn)
+		if err != nil {
+			return err
+		}
+		record := "DELETE FROM schema_migrations WHERE version=" + m.placeholder(1)
+		for i := len(m.Migrations) - 1; i >= 0 && len(done) < n; i-- {
+			mg := m.Migrations[i]
+			if _, ok := versions[mg.Version]; !ok {
+				continue
+			}
+			if err := m.step(conn, mg.Down, record, mg.Version); err != nil {
+				return fmt.Errorf("migrate down %d_%s: %w", mg.Version, mg.Name, err)
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Pending returns the migrations not applied yet. Unlike Up and Status it
+// takes no lock and creates nothing, so it is cheap enough for probes.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	rows, err := m.DB.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := map[int]bool{}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		versions[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, mg := range m.Migrations {
+		if !versions[mg.Version] {
+			pending = append(pending, mg)
+		}
+	}
+	return pending, nil
+}
+
+// Status lists every known migration; AppliedAt is empty for pending ones.
+func (m *Migrator) Status() ([]Status, error) {
+	var statuses []Status
+	err := m.session(func(conn *sql.Conn) error {
+		versions, err := applied(conn)
+		if err != nil {
+			return err
+		}
+		for _, mg := range m.Migrations {
+			statuses = append(statuses, Status{Migration: mg, AppliedAt: versions[mg.Version]})
+		}
+		return nil
+	})
+	return statuses, err
+}
@@ -0,0 +1,109 @@
+//go:build unit
+// +build unit
+
+package migrate
+
+import (
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("orders migrations by version", func(t *testing.T) {
+		ms, err := Load(fstest.MapFS{
+			"0002_second.up.sql":   {Data: []byte("up 2")},
+			"0002_second.down.sql": {Data: []byte("down 2")},
+			"0001_first.up.sql":    {Data: []byte("up 1")},
+			"0001_first.down.sql":  {Data: []byte("down 1")},
+		})
+		if assert.NoError(t, err) {
+			assert.Equal(t, []Migration{
+				{Version: 1, Name: "first", Up: "up 1", Down: "down 1"},
+				{Version: 2, Name: "second", Up: "up 2", Down: "down 2"},
+			}, ms)
+		}
+	})
+
+	t.Run("requires a down file", func(t *testing.T) {
+		_, err := Load(fstest.MapFS{"0001_first.up.sql": {Data: []byte("up 1")}})
+		assert.EqualError(t, err, "migration 1_first needs both up and down files")
+	})
+
+	t.Run("requires a version", func(t *testing.T) {
+		_, err := Load(fstest.MapFS{"first.up.sql": {Data: []byte("up 1")}})
+		assert.EqualError(t, err, "migration first.up.sql does not start with a version number")
+	})
+
+	t.Run("embedded migrations load", func(t *testing.T) {
+		for _, dialect := range []string{"postgres", "sqlite"} {
+			_, err := New(nil, dialect)
+			assert.NoError(t, err, dialect)
+		}
+	})
+}
+
+func TestMigrator(t *testing.T) {
+	t.Run("up, down and status on sqlite", func(t *testing.T) {
+		db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "m.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		m, err := New(db, "sqlite")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		done, err := m.Up()
+		assert.NoError(t, err)
+		assert.Len(t, done, len(m.Migrations))
+		_, err = db.Exec("INSERT INTO expenses(title, spent_at, created_at, updated_at) values('tea', '', '', '')")
+		assert.NoError(t, err)
+
+		done, err = m.Up()
+		assert.NoError(t, err)
+		assert.Empty(t, done)
+
+		statuses, err := m.Status()
+		if assert.NoError(t, err) {
+			assert.NotEmpty(t, statuses[0].AppliedAt)
+		}
+
+		done, err = m.Down(len(m.Migrations))
+		assert.NoError(t, err)
+		assert.Len(t, done, len(m.Migrations))
+		statuses, err = m.Status()
+		if assert.NoError(t, err) {
+			assert.Empty(t, statuses[0].AppliedAt)
+		}
+		_, err = db.Exec("SELECT 1 FROM expenses")
+		assert.Error(t, err)
+	})
+
+	t.Run("postgres migrations hold an advisory lock", func(t *testing.T) {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := &Migrator{DB: db, Dialect: "postgres", Migrations: []Migration{{Version: 1, Name: "first", Up: "CREATE TABLE t (id INT)", Down: "DROP TABLE t"}}}
+
+		mock.ExpectExec("SELECT pg_advisory_lock($1)").WithArgs(lockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at TIMESTAMPTZ NOT NULL DEFAULT now())").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT version, applied_at FROM schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}))
+		mock.ExpectBegin()
+		mock.ExpectExec("CREATE TABLE t (id INT)").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO schema_migrations(version, name) values($1, $2)").WithArgs(1, "first").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec("SELECT pg_advisory_unlock($1)").WithArgs(lockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		done, err := m.Up()
+		assert.NoError(t, err)
+		assert.Len(t, done, 1)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS expenses (
+	id SERIAL PRIMARY KEY,
+	title TEXT,
+	amount FLOAT,
+	note TEXT,
+	tags TEXT[]
+);
@@ -0,0 +1,4 @@
+ALTER TABLE expenses DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE expenses DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE expenses DROP COLUMN IF EXISTS created_at;
+ALTER TABLE expenses DROP COLUMN IF EXISTS spent_at;
@@ -0,0 +1,6 @@
+DO $$
+BEGIN
+	IF (SELECT data_type FROM information_schema.columns WHERE table_name = 'expenses' AND column_name = 'amount') = 'double precision' THEN
+		ALTER TABLE expenses ALTER COLUMN amount TYPE NUMERIC(14,2) USING round(amount::numeric, 2);
+	END IF;
+END $$;
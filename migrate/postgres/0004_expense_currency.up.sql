@@ -0,0 +1,9 @@
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'THB';
+CREATE TABLE IF NOT EXISTS exchange_rates (
+	id SERIAL PRIMARY KEY,
+	base CHAR(3) NOT NULL,
+	quote CHAR(3) NOT NULL,
+	rate NUMERIC(20,10) NOT NULL CHECK (rate > 0),
+	effective_date DATE NOT NULL,
+	UNIQUE (base, quote, effective_date)
+);
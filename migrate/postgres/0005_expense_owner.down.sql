@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS api_keys;
+DROP INDEX IF EXISTS expenses_owner_id_idx;
+ALTER TABLE expenses DROP COLUMN IF EXISTS owner_id;
@@ -0,0 +1,10 @@
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS owner_id TEXT NOT NULL DEFAULT 'legacy';
+CREATE INDEX IF NOT EXISTS expenses_owner_id_idx ON expenses (owner_id, id);
+CREATE TABLE IF NOT EXISTS api_keys (
+	id SERIAL PRIMARY KEY,
+	owner_id TEXT NOT NULL,
+	name TEXT NOT NULL DEFAULT '',
+	key_hash TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	revoked_at TIMESTAMPTZ
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS budgets (
+	id SERIAL PRIMARY KEY,
+	owner_id TEXT NOT NULL,
+	tag TEXT NOT NULL,
+	amount NUMERIC(14,2) NOT NULL,
+	currency TEXT NOT NULL DEFAULT 'THB',
+	period TEXT NOT NULL DEFAULT 'month'
+);
+CREATE INDEX IF NOT EXISTS budgets_owner_id_idx ON budgets (owner_id, id);
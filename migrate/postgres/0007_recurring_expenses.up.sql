@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS recurring_expenses (
+	id SERIAL PRIMARY KEY,
+	owner_id TEXT NOT NULL,
+	title TEXT NOT NULL,
+	amount NUMERIC(14,2) NOT NULL,
+	currency TEXT NOT NULL DEFAULT 'THB',
+	note TEXT NOT NULL DEFAULT '',
+	tags TEXT[] NOT NULL DEFAULT '{}',
+	frequency TEXT NOT NULL,
+	interval_count INTEGER NOT NULL DEFAULT 1,
+	day_of_month INTEGER NOT NULL DEFAULT 0,
+	starts_at TIMESTAMPTZ NOT NULL,
+	ends_at TIMESTAMPTZ,
+	last_run TIMESTAMPTZ,
+	next_run TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS recurring_expenses_owner_id_idx ON recurring_expenses (owner_id, id);
+CREATE INDEX IF NOT EXISTS recurring_expenses_next_run_idx ON recurring_expenses (next_run) WHERE next_run IS NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE expenses ALTER COLUMN title DROP NOT NULL, ALTER COLUMN title DROP DEFAULT;
+ALTER TABLE expenses ALTER COLUMN note DROP NOT NULL, ALTER COLUMN note DROP DEFAULT;
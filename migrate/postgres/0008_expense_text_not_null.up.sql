@@ -0,0 +1,3 @@
+UPDATE expenses SET title = COALESCE(title, ''), note = COALESCE(note, '') WHERE title IS NULL OR note IS NULL;
+ALTER TABLE expenses ALTER COLUMN title SET DEFAULT '', ALTER COLUMN title SET NOT NULL;
+ALTER TABLE expenses ALTER COLUMN note SET DEFAULT '', ALTER COLUMN note SET NOT NULL;
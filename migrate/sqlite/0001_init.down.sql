@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS exchange_rates;
+DROP TABLE IF EXISTS expenses;
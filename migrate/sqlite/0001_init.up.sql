@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS expenses (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title TEXT NOT NULL DEFAULT '',
+	amount INTEGER NOT NULL DEFAULT 0,
+	currency TEXT NOT NULL DEFAULT 'THB',
+	owner_id TEXT NOT NULL DEFAULT 'legacy',
+	note TEXT NOT NULL DEFAULT '',
+	tags TEXT,
+	spent_at TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL,
+	deleted_at TEXT
+);
+CREATE INDEX IF NOT EXISTS expenses_owner_id_idx ON expenses (owner_id, id);
+CREATE TABLE IF NOT EXISTS exchange_rates (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	base TEXT NOT NULL,
+	quote TEXT NOT NULL,
+	rate TEXT NOT NULL,
+	effective_date TEXT NOT NULL,
+	UNIQUE (base, quote, effective_date)
+);
+CREATE TABLE IF NOT EXISTS api_keys (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	owner_id TEXT NOT NULL,
+	name TEXT NOT NULL DEFAULT '',
+	key_hash TEXT NOT NULL UNIQUE,
+	created_at TEXT NOT NULL,
+	revoked_at TEXT
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS budgets (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	owner_id TEXT NOT NULL,
+	tag TEXT NOT NULL,
+	amount INTEGER NOT NULL,
+	currency TEXT NOT NULL DEFAULT 'THB',
+	period TEXT NOT NULL DEFAULT 'month'
+);
+CREATE INDEX IF NOT EXISTS budgets_owner_id_idx ON budgets (owner_id, id);
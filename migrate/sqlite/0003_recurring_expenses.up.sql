@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS recurring_expenses (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	owner_id TEXT NOT NULL,
+	title TEXT NOT NULL,
+	amount INTEGER NOT NULL,
+	currency TEXT NOT NULL DEFAULT 'THB',
+	note TEXT NOT NULL DEFAULT '',
+	tags TEXT,
+	frequency TEXT NOT NULL,
+	interval_count INTEGER NOT NULL DEFAULT 1,
+	day_of_month INTEGER NOT NULL DEFAULT 0,
+	starts_at TEXT NOT NULL,
+	ends_at TEXT,
+	last_run TEXT,
+	next_run TEXT
+);
+CREATE INDEX IF NOT EXISTS recurring_expenses_owner_id_idx ON recurring_expenses (owner_id, id);
+CREATE INDEX IF NOT EXISTS recurring_expenses_next_run_idx ON recurring_expenses (next_run) WHERE next_run IS NOT NULL;
@@ -2,36 +2,153 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github/anusornda/assessment/config"
 	"github/anusornda/assessment/expense"
+	"github/anusornda/assessment/migrate"
+	"golang.org/x/exp/slog"
+	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 )
 
 func main() {
+	cfg, args, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	logger := newLogger(cfg.Log.Level)
+	slog.SetDefault(logger)
+
+	if len(args) > 0 && args[0] == "migrate" {
+		runMigrate(cfg.DatabaseURL, args[1:])
+		return
+	}
+
+	shutdownTracing, err := expense.InitTracing(context.Background(), cfg.Tracing.Exporter)
+	if err != nil {
+		log.Fatal("can't configure tracing: ", err)
+	}
+
+	h := expense.InitDB(cfg.DatabaseURL)
+	h.MaxPageSize = cfg.MaxPageSize
+	h.DBTimeout = cfg.DB.Timeout
+	h.ConfigurePool(cfg.DB.MaxOpenConns, cfg.DB.MaxIdleConns, cfg.DB.ConnMaxLifetime)
+
+	if len(args) > 0 && args[0] == "apikey" {
+		issueAPIKey(h.Store, args[1:])
+		if err := h.Store.Close(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	authenticators, err := expense.NewAuthenticators(expense.AuthConfig{
+		JWTSecret:        cfg.Auth.JWTSecret,
+		JWTPublicKeyFile: cfg.Auth.JWTPublicKeyFile,
+		JWKSFile:         cfg.Auth.JWKSFile,
+		JWTIssuer:        cfg.Auth.JWTIssuer,
+		JWTAudience:      cfg.Auth.JWTAudience,
+		JWTMaxAge:        cfg.Auth.JWTMaxAge,
+		APIKeys:          cfg.Auth.APIKeys,
+		Legacy:           cfg.Auth.Legacy,
+	}, h.Store)
+	if err != nil {
+		log.Fatal("can't configure authentication: ", err)
+	}
 
-	h := expense.InitDB(os.Getenv("DATABASE_URL"))
+	if err := h.RegisterDBMetrics(); err != nil {
+		log.Fatal("can't register database metrics: ", err)
+	}
 
 	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.HTTPErrorHandler = expense.ErrorHandler
+
+	e.Use(expense.RequestID())
+	e.Use(expense.Logging(logger))
+	// Metrics sits outside Recover so that panics are counted as the 500s
+	// they are answered with.
+	e.Use(expense.Metrics())
+	e.Use(middleware.RecoverWithConfig(middleware.RecoverConfig{LogErrorFunc: expense.LogPanic}))
+	e.Use(expense.Tracing())
+	e.Use(middleware.BodyLimit("1M"))
+	if len(cfg.CORS.AllowOrigins) > 0 {
+		e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+			AllowOrigins:  cfg.CORS.AllowOrigins,
+			ExposeHeaders: []string{echo.HeaderXRequestID, "Link", expense.HeaderNextCursor},
+		}))
+	}
+
+	// Probes and metrics sit outside the authenticated group so that
+	// orchestrators and scrapers can reach them without credentials.
+	e.GET("/healthz", h.HealthzHandler)
+	e.GET("/readyz", h.ReadyzHandler)
+	e.GET("/metrics", expense.MetricsHandler())
+
+	g := e.Group("", expense.Authenticate(authenticators...))
 
-	e.Use(middleware.Logger())
-	e.Use(middleware.Recover())
-	e.Use(expense.CheckUserAuth())
+	g.POST("expenses", h.CreateExpensesHandler)
+	g.POST("/expenses/import", h.ImportExpensesHandler)
+	g.GET("/expenses/export", h.ExportExpensesHandler)
+	g.GET("/expenses/:id", h.GetExpensesByIdHandler)
+	g.PUT("/expenses/:id", h.UpdateExpensesByIdHandler)
+	g.PATCH("/expenses/:id", h.PatchExpensesByIdHandler)
+	g.GET("/expenses", h.GetExpensesHandler)
+	g.DELETE("/expenses/:id", h.DeleteExpensesByIdHandler)
+	g.POST("/expenses/:id/restore", h.RestoreExpensesByIdHandler)
+	g.GET("/expenses/trash", h.GetTrashExpensesHandler)
+	g.GET("/reports/summary", h.GetSummaryReportHandler)
+	g.GET("/budgets", h.GetBudgetsHandler)
+	g.POST("/budgets", h.CreateBudgetHandler)
+	g.GET("/budgets/:id", h.GetBudgetByIdHandler)
+	g.PUT("/budgets/:id", h.UpdateBudgetByIdHandler)
+	g.DELETE("/budgets/:id", h.DeleteBudgetByIdHandler)
+	g.GET("/budgets/:id/status", h.GetBudgetStatusHandler)
+	g.GET("/rates", h.GetRatesHandler)
+	// Exchange rates are shared by every owner, so only admins change them.
+	admin := expense.RequireAdmin(cfg.Auth.Admins)
+	g.POST("/rates", h.CreateRateHandler, admin)
+	g.POST("/rates/import", h.ImportRatesHandler, admin)
+	g.DELETE("/rates/:id", h.DeleteRateHandler, admin)
+	g.GET("/recurring", h.GetRecurringListHandler)
+	g.POST("/recurring", h.CreateRecurringHandler)
+	g.GET("/recurring/:id", h.GetRecurringByIdHandler)
+	g.PUT("/recurring/:id", h.UpdateRecurringByIdHandler)
+	g.DELETE("/recurring/:id", h.DeleteRecurringByIdHandler)
+	g.GET("/apikeys", h.GetAPIKeysHandler)
+	g.POST("/apikeys", h.CreateAPIKeyHandler)
+	g.DELETE("/apikeys/:id", h.RevokeAPIKeyHandler)
 
-	e.POST("expenses", h.CreateExpensesHandler)
-	e.GET("/expenses/:id", h.GetExpensesByIdHandler)
-	e.PUT("/expenses/:id", h.UpdateExpensesByIdHandler)
-	e.GET("/expenses", h.GetExpensesHandler)
+	// The scheduler stops after the server, as requests may still be
+	// creating templates, and before the store is closed.
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	schedulerDone := make(chan struct{})
+	go func() {
+		defer close(schedulerDone)
+		if cfg.Scheduler.Interval > 0 {
+			expense.NewScheduler(h.Store, cfg.Scheduler.Interval, logger).Run(schedulerCtx)
+		}
+	}()
 
-	fmt.Println("start at port:", os.Getenv("PORT"))
+	logger.Info("server starting", "addr", cfg.Port)
 
 	go func() {
-		if err := e.Start(os.Getenv("PORT")); err != nil && err != http.ErrServerClosed {
+		if err := e.Start(cfg.Port); err != nil && err != http.ErrServerClosed {
 			e.Logger.Fatal("shutting down the server")
 		}
 	}()
@@ -39,10 +156,107 @@ func main() {
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 	<-shutdown
-	ctx, cancle := context.WithTimeout(context.Background(), 10*time.Second)
+	h.BeginShutdown()
+	// Give load balancers time to see /readyz fail before connections are
+	// refused.
+	time.Sleep(cfg.Shutdown.Delay)
+	ctx, cancle := context.WithTimeout(context.Background(), cfg.Shutdown.Timeout)
 	defer cancle()
 	if err := e.Shutdown(ctx); err != nil {
+		// Closing the connections cancels the requests still running and
+		// with them their database calls.
+		e.Close()
 		e.Logger.Fatal(err)
 	}
+	stopScheduler()
+	<-schedulerDone
+	if err := h.Store.Close(); err != nil {
+		e.Logger.Fatal(err)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		e.Logger.Fatal(err)
+	}
+
+}
+
+// newLogger logs JSON lines to stdout at level, "debug", "info", "warn" or
+// "error" as checked by config.Validate.
+func newLogger(level string) *slog.Logger {
+	var l slog.Level
+	l.UnmarshalText([]byte(level))
+	return slog.New(slog.HandlerOptions{Level: l}.NewJSONHandler(os.Stdout))
+}
+
+// issueAPIKey bootstraps API access: "apikey <owner> [name]" prints a new key.
+func issueAPIKey(keys expense.APIKeyStore, args []string) {
+	if len(args) < 1 {
+		log.Fatal("usage: apikey <owner> [name]")
+	}
+	name := ""
+	if len(args) > 1 {
+		name = args[1]
+	}
+	k, err := expense.IssueAPIKey(context.Background(), keys, args[0], name)
+	if err != nil {
+		log.Fatal("can't issue api key: ", err)
+	}
+	json.NewEncoder(os.Stdout).Encode(k)
+}
+
+// runMigrate handles "migrate up", "migrate down [n]" and "migrate status".
+// The server also migrates up on start.
+func runMigrate(dbURL string, args []string) {
+	usage := "usage: migrate up | down [n] | status"
+	if len(args) < 1 {
+		log.Fatal(usage)
+	}
 
+	db, dialect, err := expense.OpenDB(dbURL)
+	if err != nil {
+		log.Fatal("Connect to database error", err)
+	}
+	defer db.Close()
+	m, err := migrate.New(db, dialect)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch args[0] {
+	case "up":
+		done, err := m.Up()
+		for _, mg := range done {
+			fmt.Printf("applied %d_%s\n", mg.Version, mg.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				log.Fatal(usage)
+			}
+		}
+		done, err := m.Down(n)
+		for _, mg := range done {
+			fmt.Printf("reverted %d_%s\n", mg.Version, mg.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, st := range statuses {
+			applied := "pending"
+			if st.AppliedAt != "" {
+				applied = "applied " + st.AppliedAt
+			}
+			fmt.Printf("%04d_%s\t%s\n", st.Version, st.Name, applied)
+		}
+	default:
+		log.Fatal(usage)
+	}
 }